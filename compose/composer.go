@@ -3,6 +3,7 @@ package compose
 import (
 	"git.yo2.cz/drahoslav/penego/net"
 	"git.yo2.cz/drahoslav/penego/draw"
+	"strconv"
 
 )
 
@@ -10,17 +11,51 @@ type Composer func(draw.Drawer)
 
 // basic "dumb" way to draw a net
 func GetSimple(network net.Net) func(draw.Drawer) {
-	places := network.Places()
-	transitions := network.Transitions()
+	return compose(network.Places(), network.Transitions(), nil)
+}
+
+// same as GetSimple, but instances of modules are drawn as boxes
+// connected to places bound to their ports
+func GetCollapsed(network net.Net) func(draw.Drawer) {
+	hiddenPlaces := map[*net.Place]bool{}
+	hiddenTransitions := map[*net.Transition]bool{}
+	for _, instance := range network.Instances() {
+		for _, p := range instance.Places {
+			hiddenPlaces[p] = true
+		}
+		for _, t := range instance.Transitions {
+			hiddenTransitions[t] = true
+		}
+	}
+
+	places := net.Places{}
+	for _, p := range network.Places() {
+		if !hiddenPlaces[p] {
+			places = append(places, p)
+		}
+	}
+	transitions := net.Transitions{}
+	for _, t := range network.Transitions() {
+		if !hiddenTransitions[t] {
+			transitions = append(transitions, t)
+		}
+	}
+
+	return compose(places, transitions, network.Instances())
+}
+
+func compose(places net.Places, transitions net.Transitions, instances []*net.Instance) func(draw.Drawer) {
 
 	const BASE = 90.0
 
+	boxes := len(transitions) + len(instances) // instances are placed after transitions
+
 	posOfPlace := func(i int) draw.Pos {
 		pos := draw.Pos{
 			X: float64(i)*BASE - (float64(len(places))/2-0.5)*BASE,
 			Y: 0,
 		}
-		if len(transitions) <= 1 {
+		if boxes <= 1 {
 			pos.Y += BASE
 		}
 		return pos
@@ -28,10 +63,10 @@ func GetSimple(network net.Net) func(draw.Drawer) {
 
 	posOfTransition := func(i int) draw.Pos {
 		pos := draw.Pos{
-			X: float64(i)*BASE - (float64(len(transitions))/2)*BASE + BASE/2,
+			X: float64(i)*BASE - (float64(boxes)/2)*BASE + BASE/2,
 			Y: 4*BASE*float64(i%2) - 2*BASE,
 		}
-		if len(transitions) <= 1 {
+		if boxes <= 1 {
 			pos.Y += BASE
 		}
 		return pos
@@ -39,11 +74,11 @@ func GetSimple(network net.Net) func(draw.Drawer) {
 
 	return Composer(func(drawer draw.Drawer) {
 		for i, p := range places {
-			drawer.DrawPlace(posOfPlace(i), p.Tokens, p.Description)
+			drawer.DrawPlace(posOfPlace(i), p.Tokens, p.Capacity, p.Description)
 		}
 
 		for ti, t := range transitions {
-			drawer.DrawTransition(posOfTransition(ti), t.TimeFunc.String(), t.Description)
+			drawer.DrawTransition(posOfTransition(ti), attributes(t), t.Description)
 			// arcs:
 			for pi, p := range places {
 				for _, arc := range t.Origins {
@@ -51,6 +86,21 @@ func GetSimple(network net.Net) func(draw.Drawer) {
 						drawer.DrawInArc(posOfPlace(pi), posOfTransition(ti), arc.Weight)
 					}
 				}
+				for _, arc := range t.Reads {
+					if arc.Place == p {
+						drawer.DrawReadArc(posOfPlace(pi), posOfTransition(ti), arc.Weight)
+					}
+				}
+				for _, arc := range t.Inhibitors {
+					if arc.Place == p {
+						drawer.DrawInhibitorArc(posOfPlace(pi), posOfTransition(ti), arc.Weight)
+					}
+				}
+				for _, arc := range t.Resets {
+					if arc.Place == p {
+						drawer.DrawResetArc(posOfPlace(pi), posOfTransition(ti))
+					}
+				}
 				for _, arc := range t.Targets {
 					if arc.Place == p {
 						drawer.DrawOutArc(posOfTransition(ti), posOfPlace(pi), arc.Weight)
@@ -58,5 +108,39 @@ func GetSimple(network net.Net) func(draw.Drawer) {
 				}
 			}
 		}
+
+		for ii, instance := range instances {
+			pos := posOfTransition(len(transitions) + ii)
+			drawer.DrawModule(pos, instance.Name+": "+instance.Module, instance.Description)
+			// arcs to ports:
+			for pi, p := range places {
+				in, out := false, false
+				for _, t := range instance.Transitions {
+					for _, arcs := range []net.Arcs{t.Origins, t.Reads, t.Inhibitors, t.Resets} {
+						for _, arc := range arcs {
+							in = in || arc.Place == p
+						}
+					}
+					for _, arc := range t.Targets {
+						out = out || arc.Place == p
+					}
+				}
+				if in {
+					drawer.DrawInArc(posOfPlace(pi), pos, 1)
+				}
+				if out {
+					drawer.DrawOutArc(pos, posOfPlace(pi), 1)
+				}
+			}
+		}
 	})
 }
+
+// attributes of transition shown under it
+func attributes(t *net.Transition) string {
+	attrs := t.TimeFunc.String()
+	if t.Servers > 0 {
+		attrs += ", servers=" + strconv.Itoa(t.Servers)
+	}
+	return attrs
+}
@@ -6,7 +6,7 @@ package draw
 //   Drawer
 //   Pos, Direction
 //   Init, Clean, Splash, Menu
-//   Place, Transition, Arc
+//   Place, Transition, Module, Arc, InhibitorArc, ResetArc, ReadArc
 
 import (
 	mgl "github.com/go-gl/mathgl/mgl64"
@@ -18,10 +18,14 @@ import (
 )
 
 type Drawer interface {
-	DrawPlace(pos Pos, n int, description string)
+	DrawPlace(pos Pos, n, capacity int, description string)
 	DrawTransition(pos Pos, attrs, description string)
+	DrawModule(pos Pos, name, description string)
 	DrawInArc(from, to Pos, weight int)
 	DrawOutArc(from, to Pos, weight int)
+	DrawInhibitorArc(from, to Pos, weight int)
+	DrawResetArc(from, to Pos)
+	DrawReadArc(from, to Pos, weight int)
 }
 
 type Pos struct {
@@ -45,6 +49,7 @@ const (
 	PLACE_RADIUS      = 24.0
 	TRANSITION_WIDTH  = 18.0
 	TRANSITION_HEIGHT = 72.0
+	INHIBITOR_RADIUS  = 6.0
 )
 
 var ( // pseudo constants
@@ -134,7 +139,7 @@ func Menu(ctx draw2d.GraphicContext, sWidth, sHeight int, itemsNames []string, a
 
 // NET entities
 
-func Place(ctx draw2d.GraphicContext, pos Pos, n int, description string) {
+func Place(ctx draw2d.GraphicContext, pos Pos, n, capacity int, description string) {
 	r := PLACE_RADIUS
 	x, y := pos.X, pos.Y
 	defer tempContext(ctx)()
@@ -185,6 +190,12 @@ func Place(ctx draw2d.GraphicContext, pos Pos, n int, description string) {
 		ctx.Restore()
 	}
 
+	// capacity
+	if capacity > 0 {
+		ctx.SetFillColor(BLACKISH)
+		ctx.FillStringAt("/"+strconv.Itoa(capacity), x+r*0.75, y+r+8) // right under
+	}
+
 	// description
 	if description != "" {
 		ctx.SetFillColor(BLACKISH)
@@ -216,6 +227,30 @@ func Transition(ctx draw2d.GraphicContext, pos Pos, attrs, description string) {
 	}
 }
 
+// Module draws collapsed instance of module as transition with double border
+func Module(ctx draw2d.GraphicContext, pos Pos, name, description string) {
+	w, h := TRANSITION_WIDTH, TRANSITION_HEIGHT
+	x, y := pos.X, pos.Y
+	defer tempContext(ctx)()
+
+	draw2dkit.Rectangle(ctx, x-w/2, y-h/2, x+w/2, y+h/2)
+	ctx.SetFillColor(LIGHT_GRAY)
+	ctx.SetStrokeColor(BLACKISH)
+	ctx.FillStroke()
+	draw2dkit.Rectangle(ctx, x-w/2+4, y-h/2+4, x+w/2-4, y+h/2-4)
+	ctx.Stroke()
+
+	// instance and module name
+	ctx.SetFillColor(BLACKISH)
+	drawCenteredString(ctx, name, x, y+h/2+20) // under
+
+	// description
+	if description != "" {
+		ctx.SetFillColor(BLACKISH)
+		drawCenteredString(ctx, description, x, y-h/2-10) //ahove
+	}
+}
+
 func Arc(ctx draw2d.GraphicContext, from, to Pos, dir Direction, weight int) {
 	r := PLACE_RADIUS
 	w := TRANSITION_WIDTH
@@ -224,23 +259,8 @@ func Arc(ctx draw2d.GraphicContext, from, to Pos, dir Direction, weight int) {
 	defer tempContext(ctx)()
 
 	if dir == In { // ( ) -> [ ]
-		angle := math.Pi * +0.25 // outgoing angle from place
-		if from.Y > to.Y {
-			angle += math.Pi
-		}
-		xo := math.Sin(angle) * r // start position on place edge related to its center
-		yo := math.Cos(angle) * r
-		to.X -= w / 2
-		from.X += xo
-		from.Y += yo
-
-		cPs = []mgl.Vec2{
-			{from.X, from.Y},
-			{from.X + 4*xo, from.Y + 4*yo},
-			{to.X - 60, to.Y},
-			{to.X, to.Y},
-		}
-		drawArrowHead(ctx, to.X, to.Y, -math.Pi/2)
+		cPs = inArcCurve(from, to, 0)
+		drawArrowHead(ctx, cPs[3].X(), cPs[3].Y(), -math.Pi/2)
 	}
 	if dir == Out { // [ ] -> ( )
 		angle := math.Pi * -0.25
@@ -261,6 +281,68 @@ func Arc(ctx draw2d.GraphicContext, from, to Pos, dir Direction, weight int) {
 		drawArrowHead(ctx, to.X, to.Y, angle)
 	}
 
+	drawArcCurve(ctx, cPs, weight)
+}
+
+// InhibitorArc draws arc from place to transition ended by small circle instead of arrow
+func InhibitorArc(ctx draw2d.GraphicContext, from, to Pos, weight int) {
+	r := INHIBITOR_RADIUS
+
+	defer tempContext(ctx)()
+
+	cPs := inArcCurve(from, to, 2*r)
+	drawArcCurve(ctx, cPs, weight)
+
+	draw2dkit.Circle(ctx, cPs[3].X()+r, cPs[3].Y(), r)
+	ctx.SetFillColor(WHITISH)
+	ctx.FillStroke()
+}
+
+// ResetArc draws dashed arc from place to transition
+func ResetArc(ctx draw2d.GraphicContext, from, to Pos) {
+	defer tempContext(ctx)()
+
+	cPs := inArcCurve(from, to, 0)
+	drawArrowHead(ctx, cPs[3].X(), cPs[3].Y(), -math.Pi/2)
+	ctx.SetLineDash([]float64{8, 6}, 0)
+	drawArcCurve(ctx, cPs, 1)
+}
+
+// ReadArc draws arc from place to transition without arrow head
+func ReadArc(ctx draw2d.GraphicContext, from, to Pos, weight int) {
+	defer tempContext(ctx)()
+
+	cPs := inArcCurve(from, to, 0)
+	drawArcCurve(ctx, cPs, weight)
+}
+
+// help functions
+
+// control points of curve from place to transition
+// gap is space left between end of curve and transition
+func inArcCurve(from, to Pos, gap float64) []mgl.Vec2 {
+	r := PLACE_RADIUS
+	w := TRANSITION_WIDTH
+
+	angle := math.Pi * +0.25 // outgoing angle from place
+	if from.Y > to.Y {
+		angle += math.Pi
+	}
+	xo := math.Sin(angle) * r // start position on place edge related to its center
+	yo := math.Cos(angle) * r
+	to.X -= w/2 + gap
+	from.X += xo
+	from.Y += yo
+
+	return []mgl.Vec2{
+		{from.X, from.Y},
+		{from.X + 4*xo, from.Y + 4*yo},
+		{to.X - 60, to.Y},
+		{to.X, to.Y},
+	}
+}
+
+func drawArcCurve(ctx draw2d.GraphicContext, cPs []mgl.Vec2, weight int) {
 	ctx.MoveTo(cPs[0].X(), cPs[0].Y())
 	ctx.CubicCurveTo(
 		cPs[1].X(), cPs[1].Y(),
@@ -280,8 +362,6 @@ func Arc(ctx draw2d.GraphicContext, from, to Pos, dir Direction, weight int) {
 	}
 }
 
-// help functions
-
 func drawArrowHead(ctx draw2d.GraphicContext, x, y float64, angle float64) {
 	r := 18.0
 	w := math.Pi / 8
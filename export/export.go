@@ -16,9 +16,9 @@ type ImgDrawer struct {
 	ctx draw2d.GraphicContext
 }
 
-func (drawer ImgDrawer) DrawPlace(pos draw.Pos, n int, description string) {
+func (drawer ImgDrawer) DrawPlace(pos draw.Pos, n, capacity int, description string) {
 	if drawer.ctx != nil {
-		draw.Place(drawer.ctx, pos, n, description)
+		draw.Place(drawer.ctx, pos, n, capacity, description)
 	}
 }
 
@@ -28,6 +28,12 @@ func (drawer ImgDrawer) DrawTransition(pos draw.Pos, attrs, description string)
 	}
 }
 
+func (drawer ImgDrawer) DrawModule(pos draw.Pos, name, description string) {
+	if drawer.ctx != nil {
+		draw.Module(drawer.ctx, pos, name, description)
+	}
+}
+
 func (drawer ImgDrawer) DrawInArc(from draw.Pos, to draw.Pos, weight int) {
 	if drawer.ctx != nil {
 		draw.Arc(drawer.ctx, from, to, draw.In, weight)
@@ -40,6 +46,24 @@ func (drawer ImgDrawer) DrawOutArc(from draw.Pos, to draw.Pos, weight int) {
 	}
 }
 
+func (drawer ImgDrawer) DrawInhibitorArc(from draw.Pos, to draw.Pos, weight int) {
+	if drawer.ctx != nil {
+		draw.InhibitorArc(drawer.ctx, from, to, weight)
+	}
+}
+
+func (drawer ImgDrawer) DrawResetArc(from draw.Pos, to draw.Pos) {
+	if drawer.ctx != nil {
+		draw.ResetArc(drawer.ctx, from, to)
+	}
+}
+
+func (drawer ImgDrawer) DrawReadArc(from draw.Pos, to draw.Pos, weight int) {
+	if drawer.ctx != nil {
+		draw.ReadArc(drawer.ctx, from, to, weight)
+	}
+}
+
 func getName(ext string) string {
 	return fmt.Sprintf("%s.%s", filename, ext) // TODO prompt user
 }
@@ -17,6 +17,10 @@ func nameToKey(key string) glfw.Key {
 		return glfw.KeySpace
 	case key == "home":
 		return glfw.KeyHome
+	case key == "left":
+		return glfw.KeyLeft
+	case key == "right":
+		return glfw.KeyRight
 	default:
 		return glfw.KeyUnknown
 	}
@@ -110,9 +114,9 @@ func (s *Screen) SetTitle(title string) {
 	}, false)
 }
 
-func (s *Screen) DrawPlace(pos draw.Pos, n int, description string) {
+func (s *Screen) DrawPlace(pos draw.Pos, n, capacity int, description string) {
 	if s.ctx != nil {
-		draw.Place(s.ctx, pos, n, description)
+		draw.Place(s.ctx, pos, n, capacity, description)
 	}
 }
 
@@ -122,6 +126,12 @@ func (s *Screen) DrawTransition(pos draw.Pos, attrs, description string) {
 	}
 }
 
+func (s *Screen) DrawModule(pos draw.Pos, name, description string) {
+	if s.ctx != nil {
+		draw.Module(s.ctx, pos, name, description)
+	}
+}
+
 func (s *Screen) DrawInArc(from draw.Pos, to draw.Pos, weight int) {
 	if s.ctx != nil {
 		draw.Arc(s.ctx, from, to, draw.In, weight)
@@ -134,6 +144,24 @@ func (s *Screen) DrawOutArc(from draw.Pos, to draw.Pos, weight int) {
 	}
 }
 
+func (s *Screen) DrawInhibitorArc(from draw.Pos, to draw.Pos, weight int) {
+	if s.ctx != nil {
+		draw.InhibitorArc(s.ctx, from, to, weight)
+	}
+}
+
+func (s *Screen) DrawResetArc(from draw.Pos, to draw.Pos) {
+	if s.ctx != nil {
+		draw.ResetArc(s.ctx, from, to)
+	}
+}
+
+func (s *Screen) DrawReadArc(from draw.Pos, to draw.Pos, weight int) {
+	if s.ctx != nil {
+		draw.ReadArc(s.ctx, from, to, weight)
+	}
+}
+
 func (s *Screen) OnKey(keyName string, cb func()) {
 	var prevcb glfw.KeyCallback
 	prevcb = s.Window.SetKeyCallback(func(w *glfw.Window, key glfw.Key, scanCode int, action glfw.Action, mods glfw.ModifierKey) {
@@ -0,0 +1,236 @@
+package net
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"testing"
+	"time"
+)
+
+/******* helpers *******/
+
+// generated net of n independent timed transitions,
+// each has its own place with tokens, so all its tokens are scheduled concurrently
+func generateTimedNet(n, tokens int) Net {
+	places := Places{}
+	transitions := Transitions{}
+	for i := 0; i < n; i++ {
+		place := &Place{Tokens: tokens, id: fmt.Sprintf("p%d", i)}
+		places.Push(place)
+		transitions.Push(Transition{
+			Origins: Arcs{{Weight: 1, Place: place}},
+			Targets: Arcs{{Weight: 1, Place: place}},
+			TimeFunc: GetExponentialTimeFunc(time.Minute),
+			Priority: i % 3,
+			Description: fmt.Sprintf("t%d", i),
+		})
+	}
+	return New(places, transitions)
+}
+
+// random times of events, with many collisions, so ties are resolved by priority and order
+func randomTimes(rnd *rand.Rand, n int) []time.Duration {
+	times := make([]time.Duration, n)
+	for i := range times {
+		times[i] = time.Duration(rnd.Intn(n/4 + 1)) * time.Second
+	}
+	return times
+}
+
+/* linearCalendar */
+
+// linearCalendar is sorted slice of events as calendar was implemented before heap,
+// kept only to compare speed
+type linearCalendar struct {
+	events []*Event
+	seq uint64
+}
+
+func (c *linearCalendar) insertByTime(newTime time.Duration, tran *Transition) {
+	c.seq++
+	event := &Event{time: newTime, transition: tran, seq: c.seq}
+	i := len(c.events)
+	for j, e := range c.events {
+		if event.before(e) {
+			i = j
+			break
+		}
+	}
+	c.events = append(c.events, nil)
+	copy(c.events[i+1:], c.events[i:])
+	c.events[i] = event
+}
+
+func (c *linearCalendar) shift() (time.Duration, *Transition) {
+	event := c.events[0]
+	c.events = c.events[1:]
+	return event.time, event.transition
+}
+
+func (c *linearCalendar) removeLatest(tran *Transition) time.Duration {
+	for i := len(c.events) - 1; i >= 0; i-- {
+		if event := c.events[i]; event.transition == tran {
+			c.events = append(c.events[:i], c.events[i+1:]...)
+			return event.time
+		}
+	}
+	return 0
+}
+
+/******* tests *******/
+
+func TestCalendarOrder(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	net := generateTimedNet(50, 1)
+	immediate := &Transition{Priority: 5}
+	trans := append(net.Transitions(), immediate)
+
+	calendar := newCalendar()
+	inserted := map[*Transition]int{}
+	for _, eventTime := range randomTimes(rnd, 2000) {
+		tran := trans[rnd.Intn(len(trans))]
+		calendar.insertByTime(eventTime, tran)
+		inserted[tran]++
+	}
+	for tran, n := range inserted {
+		if calendar.count(tran) != n {
+			t.Fatalf("count of %s is %d, expected %d", tran.Description, calendar.count(tran), n)
+		}
+	}
+
+	// latest event of transition is removed, the others stay
+	removed := trans[0]
+	for calendar.count(removed) > 1 {
+		latest := calendar.byTransition[removed][0]
+		for _, event := range calendar.byTransition[removed] {
+			if latest.before(event) {
+				latest = event
+			}
+		}
+		if got := calendar.removeLatest(removed); got != latest.time {
+			t.Fatalf("removeLatest returned %s, expected %s", got, latest.time)
+		}
+	}
+
+	var previous *Event
+	for !calendar.isEmpty() {
+		event := calendar.events[0]
+		eventTime, tran := calendar.shift()
+		if eventTime != event.time || tran != event.transition {
+			t.Fatalf("shift returned %s %s, expected %s %s", eventTime, tran.Description, event.time, event.transition.Description)
+		}
+		if previous != nil && !previous.before(event) {
+			t.Fatalf("event at %s (p=%d, seq=%d) popped after event at %s (p=%d, seq=%d)",
+				event.time, tran.Priority, event.seq, previous.time, previous.transition.Priority, previous.seq)
+		}
+		previous = event
+	}
+	for tran := range inserted {
+		if calendar.count(tran) != 0 {
+			t.Fatalf("%s has events left in index of empty calendar", tran.Description)
+		}
+	}
+}
+
+/******* benchmarks *******/
+
+// sizes of calendar, ie. count of concurrently scheduled events
+var calendarSizes = []int{100, 1000, 10000}
+
+func BenchmarkCalendarInsert(b *testing.B) {
+	for _, size := range calendarSizes {
+		trans := generateTimedNet(size, 1).transitions
+		times := randomTimes(rand.New(rand.NewSource(1)), size)
+		b.Run(fmt.Sprintf("heap/%d", size), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				calendar := newCalendar()
+				for j, tran := range trans {
+					calendar.insertByTime(times[j], tran)
+				}
+			}
+		})
+		b.Run(fmt.Sprintf("linear/%d", size), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				calendar := linearCalendar{}
+				for j, tran := range trans {
+					calendar.insertByTime(times[j], tran)
+				}
+			}
+		})
+	}
+}
+
+// shift of first event followed by insert of new one, as simulation does in steady state
+func BenchmarkCalendarShift(b *testing.B) {
+	for _, size := range calendarSizes {
+		trans := generateTimedNet(size, 1).transitions
+		rnd := rand.New(rand.NewSource(1))
+		times := randomTimes(rnd, size)
+		b.Run(fmt.Sprintf("heap/%d", size), func(b *testing.B) {
+			calendar := newCalendar()
+			for j, tran := range trans {
+				calendar.insertByTime(times[j], tran)
+			}
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				now, tran := calendar.shift()
+				calendar.insertByTime(now + times[i%size], tran)
+			}
+		})
+		b.Run(fmt.Sprintf("linear/%d", size), func(b *testing.B) {
+			calendar := linearCalendar{}
+			for j, tran := range trans {
+				calendar.insertByTime(times[j], tran)
+			}
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				now, tran := calendar.shift()
+				calendar.insertByTime(now + times[i%size], tran)
+			}
+		})
+	}
+}
+
+// cancel of latest event of transition followed by its rescheduling, as disabling does
+func BenchmarkCalendarRemoveLatest(b *testing.B) {
+	for _, size := range calendarSizes {
+		trans := generateTimedNet(size, 1).transitions
+		rnd := rand.New(rand.NewSource(1))
+		times := randomTimes(rnd, size)
+		b.Run(fmt.Sprintf("heap/%d", size), func(b *testing.B) {
+			calendar := newCalendar()
+			for j, tran := range trans {
+				calendar.insertByTime(times[j], tran)
+			}
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				tran := trans[i%size]
+				calendar.insertByTime(calendar.removeLatest(tran), tran)
+			}
+		})
+		b.Run(fmt.Sprintf("linear/%d", size), func(b *testing.B) {
+			calendar := linearCalendar{}
+			for j, tran := range trans {
+				calendar.insertByTime(times[j], tran)
+			}
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				tran := trans[i%size]
+				calendar.insertByTime(calendar.removeLatest(tran), tran)
+			}
+		})
+	}
+}
+
+// whole simulation of generated net with thousands of scheduled events
+func BenchmarkSimulationGenerated(b *testing.B) {
+	for _, size := range []int{100, 1000} {
+		b.Run(fmt.Sprintf("%dx10", size), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				sim := NewSimulation(0, time.Minute, generateTimedNet(size, 10))
+				sim.Run(context.Background())
+			}
+		})
+	}
+}
@@ -0,0 +1,288 @@
+package net
+
+import (
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+/******* types *******/
+
+/* ColourSet */
+
+// ColourSet is type of tokens of coloured place
+// it is either set of all integers or enumeration of named atoms
+type ColourSet struct {
+	Name  string
+	Atoms []string // nil for integers
+}
+
+// IntColours is set of all integers
+var IntColours = &ColourSet{Name: "int"}
+
+// Contains checks whether value is member of colour set
+func (cs *ColourSet) Contains(value int) bool {
+	if cs.Atoms == nil {
+		return true
+	}
+	return value >= 0 && value < len(cs.Atoms)
+}
+
+// Format returns text representation of value, atom name for enumerations
+func (cs *ColourSet) Format(value int) string {
+	if cs.Atoms != nil && cs.Contains(value) {
+		return cs.Atoms[value]
+	}
+	return strconv.Itoa(value)
+}
+
+func (cs ColourSet) String() string {
+	if cs.Atoms == nil {
+		return cs.Name
+	}
+	return "colset " + cs.Name + " = {" + strings.Join(cs.Atoms, ", ") + "}"
+}
+
+/* Multiset */
+
+// Multiset holds count of tokens for each value of coloured place
+type Multiset map[int]int
+
+func (ms Multiset) Add(value, n int) {
+	ms[value] += n
+}
+
+func (ms Multiset) Remove(value, n int) {
+	ms[value] -= n
+	if ms[value] < 0 {
+		panic("impossible transition done")
+	}
+	if ms[value] == 0 {
+		delete(ms, value)
+	}
+}
+
+// Values returns distinct values in ascending order
+func (ms Multiset) Values() []int {
+	values := make([]int, 0, len(ms))
+	for value := range ms {
+		values = append(values, value)
+	}
+	sort.Ints(values)
+	return values
+}
+
+// randomOrder returns distinct values in random order,
+// value with more tokens tends to be earlier
+// without generator values are in ascending order
+func (ms Multiset) randomOrder(rnd *rand.Rand) []int {
+	values := ms.Values()
+	if rnd == nil {
+		return values
+	}
+	weights := make([]int, len(values))
+	sum := 0
+	for i, value := range values {
+		weights[i] = ms[value]
+		sum += ms[value]
+	}
+	order := make([]int, 0, len(values))
+	for len(values) > 0 {
+		r := rnd.Intn(sum)
+		i := 0
+		for ; r >= weights[i]; i++ {
+			r -= weights[i]
+		}
+		order = append(order, values[i])
+		sum -= weights[i]
+		values = append(values[:i], values[i+1:]...)
+		weights = append(weights[:i], weights[i+1:]...)
+	}
+	return order
+}
+
+func (ms Multiset) copy() Multiset {
+	dup := make(Multiset, len(ms))
+	for value, n := range ms {
+		dup[value] = n
+	}
+	return dup
+}
+
+// format in penego notation, eg. `1, 2*3`
+func (ms Multiset) format(cs *ColourSet) string {
+	strs := make([]string, 0, len(ms))
+	for _, value := range ms.Values() {
+		if ms[value] > 1 {
+			strs = append(strs, strconv.Itoa(ms[value])+"*"+cs.Format(value))
+		} else {
+			strs = append(strs, cs.Format(value))
+		}
+	}
+	return strings.Join(strs, ", ")
+}
+
+/* binding */
+
+// binding assigns values to variables of transition
+type binding map[string]int
+
+func (b binding) lookup(name string) (int, bool) {
+	value, ok := b[name]
+	return value, ok
+}
+
+/******* transition methods related to colours *******/
+
+// whether transition has to find binding of its variables to be enabled
+func (t *Transition) needsBinding() bool {
+	if t.Guard != nil {
+		return true
+	}
+	for _, arcs := range []Arcs{t.Origins, t.Targets} {
+		for _, arc := range arcs {
+			if arc.Inscription != nil {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (t *Transition) guardHolds(b binding) bool {
+	if t.Guard == nil {
+		return true
+	}
+	value, err := t.Guard.Eval(b.lookup)
+	return err == nil && value != 0
+}
+
+// whether inscriptions of all targets can be evaluated to values of their colour sets
+func (t *Transition) canPut(b binding) bool {
+	for _, arc := range t.Targets {
+		if arc.Inscription != nil {
+			value, err := arc.Inscription.Eval(b.lookup)
+			if err != nil || !arc.Place.Colours.Contains(value) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+/**
+ * Find binding for which all inscribed origins have tokens, guard holds
+ * and values of all inscribed targets are valid
+ * with generator tokens are tried in random order, so no value is preferred,
+ * without it in ascending order, so checks of enabling draw no random numbers
+ */
+func (t *Transition) findBinding(rnd *rand.Rand) (binding, bool) {
+	// origins binding new variable go first, so the rest can be evaluated
+	arcs := make(Arcs, 0, len(t.Origins))
+	for _, arc := range t.Origins {
+		if _, ok := arc.Inscription.Ident(); ok {
+			arcs = append(arcs, arc)
+		}
+	}
+	for _, arc := range t.Origins {
+		if _, ok := arc.Inscription.Ident(); !ok {
+			arcs = append(arcs, arc)
+		}
+	}
+
+	b := binding{}
+	var try func(i int) bool
+	try = func(i int) bool {
+		if i == len(arcs) {
+			return t.guardHolds(b) && t.canPut(b)
+		}
+		arc := arcs[i]
+		if arc.Inscription == nil {
+			return try(i + 1)
+		}
+		if name, ok := arc.Inscription.Ident(); ok {
+			if _, bound := b[name]; !bound {
+				for _, value := range arc.Place.Values.randomOrder(rnd) {
+					if arc.Place.Values[value] >= arc.Weight {
+						b[name] = value
+						if try(i + 1) {
+							return true
+						}
+					}
+				}
+				delete(b, name)
+				return false
+			}
+		}
+		value, err := arc.Inscription.Eval(b.lookup)
+		if err != nil || arc.Place.Values[value] < arc.Weight {
+			return false
+		}
+		return try(i + 1)
+	}
+
+	if try(0) {
+		return b, true
+	}
+	return nil, false
+}
+
+// removes values of tokens given by binding from origins
+func (t *Transition) takeValues(b binding) {
+	for _, arc := range t.Origins {
+		if arc.Inscription != nil {
+			value, _ := arc.Inscription.Eval(b.lookup)
+			arc.Place.Values.Remove(value, arc.Weight)
+		}
+	}
+}
+
+// adds values of tokens given by binding to targets
+func (t *Transition) putValues(b binding) {
+	for _, arc := range t.Targets {
+		if arc.Inscription != nil {
+			value, err := arc.Inscription.Eval(b.lookup)
+			if err != nil {
+				panic(err)
+			}
+			if !arc.Place.Colours.Contains(value) {
+				panic("value " + strconv.Itoa(value) + " is not in colour set " + arc.Place.Colours.Name)
+			}
+			arc.Place.Values.Add(value, arc.Weight)
+		}
+	}
+}
+
+/**
+ * How many disjoint bindings can be found with current values of tokens
+ * limit is enability given by number of tokens
+ */
+func (t *Transition) getBindingMagnitude(limit int) int {
+	saved := map[*Place]Multiset{}
+	for _, arc := range t.Origins {
+		if arc.Inscription != nil {
+			saved[arc.Place] = arc.Place.Values.copy()
+		}
+	}
+	if len(saved) == 0 { // guard or targets only, nothing is consumed by binding
+		if _, ok := t.findBinding(nil); ok {
+			return limit
+		}
+		return 0
+	}
+
+	n := 0
+	for ; n < limit; n++ {
+		b, ok := t.findBinding(nil)
+		if !ok {
+			break
+		}
+		t.takeValues(b)
+	}
+
+	for place, values := range saved {
+		place.Values = values
+	}
+	return n
+}
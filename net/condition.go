@@ -0,0 +1,126 @@
+package net
+
+import (
+	"errors"
+	"strconv"
+)
+
+/******* types *******/
+
+/* StopCondition */
+
+// StopCondition ends simulation right after firing which makes it hold
+// condition is bound to net of simulation by Simulation.StopWhen,
+// so the same condition can be used for clones of net
+type StopCondition struct {
+	description string
+	bind func(net *Net) (func(sim *Simulation, fired *Transition) bool, error)
+}
+
+func (cond StopCondition) String() string {
+	return cond.description
+}
+
+/******* exported functions *******/
+
+// MarkingCondition holds when predicate over marking is true, eg. `o >= 1000 || q > 2*k`
+// identifiers in predicate are ids of places
+func MarkingCondition(predicate string) (StopCondition, error) {
+	if _, err := ParseExpr(predicate, nil); err != nil {
+		return StopCondition{}, errors.New(err.Error() + " in condition `" + predicate + "`")
+	}
+	return StopCondition{
+		description: "`" + predicate + "`",
+		bind: func(net *Net) (func(*Simulation, *Transition) bool, error) {
+			expr, _ := ParseExpr(predicate, nil) // each net needs its own copy
+			expr.bindPlaces(func(name string) (*Place, bool) {
+				for _, place := range net.places {
+					if place.id == name {
+						return place, true
+					}
+				}
+				return nil, false
+			})
+			if unknown := expr.Idents(); len(unknown) > 0 {
+				return nil, errors.New("unknown place `" + unknown[0] + "` in condition `" + predicate + "`")
+			}
+			return func(*Simulation, *Transition) bool {
+				value, err := expr.Eval(nil)
+				return err == nil && value != 0
+			}, nil
+		},
+	}, nil
+}
+
+// MaxFiringsCondition holds when count of all firings since start reaches max
+func MaxFiringsCondition(max int) StopCondition {
+	return StopCondition{
+		description: strconv.Itoa(max) + " firings",
+		bind: func(*Net) (func(*Simulation, *Transition) bool, error) {
+			return func(sim *Simulation, _ *Transition) bool {
+				return sim.firings >= max
+			}, nil
+		},
+	}
+}
+
+// FirstFiringCondition holds when transition fires for the first time
+// transition is identified by its description or by its notation, eg. `g -> [exp(1s)] -> g, e`
+func FirstFiringCondition(name string) StopCondition {
+	return StopCondition{
+		description: "first firing of `" + name + "`",
+		bind: func(net *Net) (func(*Simulation, *Transition) bool, error) {
+			for _, tran := range net.transitions {
+				if tran.Description == name || tran.String() == name {
+					tran := tran
+					return func(_ *Simulation, fired *Transition) bool {
+						return fired == tran
+					}, nil
+				}
+			}
+			return nil, errors.New("unknown transition `" + name + "` in condition")
+		},
+	}
+}
+
+/******* simulation methods related to stop conditions *******/
+
+// StopWhen adds condition which ends Run, see StopReason and MetCondition
+func (sim *Simulation) StopWhen(cond StopCondition) error {
+	holds, err := cond.bind(&sim.net)
+	if err != nil {
+		return err
+	}
+	sim.conditions = append(sim.conditions, cond)
+	sim.holds = append(sim.holds, holds)
+	return nil
+}
+
+// MetCondition returns condition which ended simulation, if StopReason is ConditionMet
+func (sim *Simulation) MetCondition() (StopCondition, bool) {
+	c := sim.control
+	if c == nil {
+		return StopCondition{}, false
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.reason != ConditionMet {
+		return StopCondition{}, false
+	}
+	return sim.conditions[c.met], true
+}
+
+// counts firing and checks whether any condition holds after it
+// fired is nil for initial marking, which is not counted
+func (sim *Simulation) checkConditions(fired *Transition) {
+	if fired != nil {
+		sim.firings++
+	}
+	for i, holds := range sim.holds {
+		if holds(sim, fired) {
+			sim.reason = ConditionMet
+			sim.met = i
+			return
+		}
+	}
+}
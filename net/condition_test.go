@@ -0,0 +1,72 @@
+package net
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+/******* helpers *******/
+
+func mustMarkingCondition(t *testing.T, predicate string) StopCondition {
+	cond, err := MarkingCondition(predicate)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cond
+}
+
+/******* tests *******/
+
+// place inside instance of module is identified by its dotted id
+func TestMarkingConditionOnModulePlace(t *testing.T) {
+	src := `module Server(in, out) {
+	busy ( ) "serving"
+	in -> [] -> busy
+	busy -> [1m] -> out
+}
+g (1)
+f ( ) "queue"
+o ( )
+----
+g -> [10s] -> g, f
+s1 = Server(f, o)`
+	net, err := Parse(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sim := NewSimulation(0, time.Hour, net)
+	cond, err := MarkingCondition("s1.busy >= 2 && o == 0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := sim.StopWhen(cond); err != nil {
+		t.Fatal(err)
+	}
+	sim.Run(context.Background())
+	if sim.StopReason() != ConditionMet || sim.GetNow() != 20*time.Second {
+		t.Errorf("run ended by %s at %s, expected %s at 20s", sim.StopReason(), sim.GetNow(), ConditionMet)
+	}
+}
+
+// condition satisfied by initial marking ends simulation before first firing
+func TestConditionMetInitially(t *testing.T) {
+	for _, cond := range []StopCondition{MaxFiringsCondition(0), mustMarkingCondition(t, "o >= 0")} {
+		net, err := Parse("g (1)\no ()\n----\ng -> [1s] -> g, o")
+		if err != nil {
+			t.Fatal(err)
+		}
+		sim := NewSimulation(0, time.Minute, net)
+		if err := sim.StopWhen(cond); err != nil {
+			t.Fatal(err)
+		}
+		if tran, _ := sim.Step(); tran != nil {
+			t.Errorf("%s: step fired %s", cond, tran.Description)
+		}
+		sim.Run(context.Background())
+		if sim.StopReason() != ConditionMet || sim.GetNow() != 0 || net.places[1].Tokens != 0 {
+			t.Errorf("%s: run ended by %s at %s with %d tokens, expected %s at 0s with none",
+				cond, sim.StopReason(), sim.GetNow(), net.places[1].Tokens, ConditionMet)
+		}
+	}
+}
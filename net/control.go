@@ -0,0 +1,211 @@
+package net
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+/******* types *******/
+
+/* StopReason */
+
+// StopReason tells why simulation ended
+type StopReason int
+
+const (
+	NotEnded StopReason = iota // simulation was not run or can continue
+	EndReached // next event would occur after end time
+	NoEvents // nothing is enabled nor scheduled, marking stays the same until end time
+	Stopped // Stop was called
+	Canceled // context of Run was canceled
+	ConditionMet // one of stop conditions holds
+)
+
+func (reason StopReason) String() string {
+	return map[StopReason]string{
+		NotEnded: "not ended",
+		EndReached: "end time reached",
+		NoEvents: "no more events",
+		Stopped: "stopped",
+		Canceled: "canceled",
+		ConditionMet: "condition met",
+	}[reason]
+}
+
+/* control */
+
+// control of running simulation
+// its methods are safe to call from any goroutine
+type control struct {
+	mutex sync.Mutex
+	changed *sync.Cond // broadcasted whenever state of control changes
+	running bool
+	pause bool // pause is requested
+	paused bool // Run is actually waiting
+	stop bool // stop is requested
+	now time.Duration // copy of simulation time for other goroutines
+	reason StopReason // copy of reason why simulation ended
+	met int // copy of index of condition which ended simulation
+}
+
+func newControl() *control {
+	c := &control{}
+	c.changed = sync.NewCond(&c.mutex)
+	return c
+}
+
+// start marks beginning of Run, returns false if it is already running
+func (c *control) start() bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.running {
+		return false
+	}
+	c.running = true
+	c.stop = false
+	return true
+}
+
+// finish marks end of Run, calls onStop if it was stopped
+func (c *control) finish(onStop func()) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.stop {
+		onStop()
+	}
+	c.running, c.pause, c.paused, c.stop = false, false, false, false
+	c.changed.Broadcast()
+}
+
+// proceed blocks while pause is requested
+// returns false when Run should end, because it was stopped or ctx was canceled
+func (c *control) proceed(ctx context.Context) bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	for c.pause && !c.stop && ctx.Err() == nil {
+		if !c.paused {
+			c.paused = true
+			c.changed.Broadcast()
+		}
+		c.changed.Wait()
+	}
+	if c.paused {
+		c.paused = false
+		c.changed.Broadcast()
+	}
+	return !c.stop && ctx.Err() == nil
+}
+
+// wakes up waiting Run, so it can check its context
+func (c *control) wake() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.changed.Broadcast()
+}
+
+// calls fun while control is locked, so other goroutines see consistent state of simulation
+func (c *control) locked(fun func()) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	fun()
+}
+
+/******* simulation methods related to control *******/
+
+// copies state of simulation to control, so other goroutines can read it
+// caller has to hold lock of control
+func (sim *Simulation) publish() {
+	c := sim.control
+	c.now, c.reason, c.met = sim.now, sim.reason, sim.met
+}
+
+// zero Simulation has no control, its methods do nothing
+
+// Pause pauses running simulation as soon as current firing is done
+// Run blocks until Resume or Stop is called
+func (sim *Simulation) Pause() {
+	c := sim.control
+	if c == nil {
+		return
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.pause = true
+	c.changed.Broadcast()
+}
+
+// Resume continues paused simulation
+func (sim *Simulation) Resume() {
+	c := sim.control
+	if c == nil {
+		return
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.pause = false
+	c.changed.Broadcast()
+}
+
+// WaitPaused blocks until requested pause really takes effect,
+// returns immediately if pause is not requested or simulation does not run
+func (sim *Simulation) WaitPaused() {
+	c := sim.control
+	if c == nil {
+		return
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	for c.running && c.pause && !c.paused && !c.stop {
+		c.changed.Wait()
+	}
+}
+
+// IsPaused tells whether Run is waiting in pause
+func (sim *Simulation) IsPaused() bool {
+	c := sim.control
+	if c == nil {
+		return false
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.paused
+}
+
+// Stop ends running simulation and restores initial marking of net
+// it does not wait for Run to return
+func (sim *Simulation) Stop() {
+	c := sim.control
+	if c == nil {
+		return
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.running {
+		c.stop = true // simulation is reset by Run
+		c.changed.Broadcast()
+	} else {
+		sim.reset()
+	}
+}
+
+// StopReason tells why last Run or Step ended simulation
+func (sim *Simulation) StopReason() StopReason {
+	c := sim.control
+	if c == nil {
+		return NotEnded
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.reason
+}
+
+func (sim *Simulation) GetNow() time.Duration {
+	c := sim.control
+	if c == nil {
+		return 0
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.now
+}
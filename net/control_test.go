@@ -0,0 +1,64 @@
+package net
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+/******* tests *******/
+
+// methods of simulation can be called from other goroutine while Run is running,
+// it is meant to be run with -race
+func TestControlConcurrentReads(t *testing.T) {
+	net, err := Parse("g (1)\nq ()\nb (1/1)\n----\ng -> [exp(1s)] -> g, q\nq, !b -> [] -> b\nb -> [exp(500ms)]")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sim := NewSimulation(0, 10*time.Hour, net)
+	sim.SetWarmUp(time.Minute)
+	sim.SetBatches(5)
+	if err := sim.StopWhen(MaxFiringsCondition(20000)); err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan struct{})
+	go func() {
+		sim.Run(context.Background())
+		close(done)
+	}()
+	for running := true; running; {
+		select {
+		case <-done:
+			running = false
+		default:
+			sim.Statistics()
+			sim.Batches()
+			sim.StopReason()
+			sim.MetCondition()
+			sim.GetNow()
+			sim.IsPaused()
+		}
+	}
+	if sim.StopReason() != ConditionMet {
+		t.Errorf("simulation ended by %s, expected %s", sim.StopReason(), ConditionMet)
+	}
+	if firings := sim.Statistics().Transitions[0].Firings; firings == 0 {
+		t.Errorf("no firings collected")
+	}
+}
+
+// zero Simulation has no control, its methods must not panic
+func TestControlZeroSimulation(t *testing.T) {
+	var sim Simulation
+	sim.Stop()
+	sim.Pause()
+	sim.Resume()
+	sim.WaitPaused()
+	sim.Run(context.Background())
+	if tran, _ := sim.Step(); tran != nil {
+		t.Errorf("zero simulation fired %s", tran)
+	}
+	if sim.StepBack() || sim.IsPaused() || sim.StopReason() != NotEnded || sim.GetNow() != 0 {
+		t.Errorf("zero simulation is not in initial state")
+	}
+}
@@ -0,0 +1,167 @@
+package net
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+	"testing"
+	"time"
+)
+
+/******* helpers *******/
+
+// random net in penego notation with inhibitor, read, reset arcs, capacities, guards,
+// source transitions (with hidden self loop place), servers and memory policies
+// immediate transitions move tokens only to places with higher index, so they can not loop forever
+func generateRandomNet(rnd *rand.Rand, placeCount, transitionCount int) string {
+	var src strings.Builder
+	for i := 0; i < placeCount; i++ {
+		if rnd.Intn(3) == 0 {
+			capacity := 1 + rnd.Intn(4)
+			fmt.Fprintf(&src, "p%d (%d/%d)\n", i, rnd.Intn(capacity+1), capacity)
+		} else {
+			fmt.Fprintf(&src, "p%d (%d)\n", i, rnd.Intn(4))
+		}
+	}
+	src.WriteString("----\n")
+	place := func(from, to int) string {
+		return fmt.Sprintf("p%d", from+rnd.Intn(to-from))
+	}
+	for i := 0; i < transitionCount; i++ {
+		timed := rnd.Intn(3) != 0
+		ins, outs, attrs := []string{}, []string{}, []string{}
+		used := map[string]bool{} // place can be used only once on each side
+		arc := func(arcs *[]string, prefix string, from, to int) {
+			name := place(from, to)
+			if used[name] {
+				return
+			}
+			used[name] = true
+			if prefix == "" && rnd.Intn(3) == 0 {
+				*arcs = append(*arcs, "2*"+name)
+			} else {
+				*arcs = append(*arcs, prefix+name)
+			}
+		}
+		split := 1 + rnd.Intn(placeCount-1) // immediate consume below split and produce above it
+		if timed {
+			split = placeCount
+		}
+		origins := rnd.Intn(3)
+		if !timed && origins == 0 {
+			origins = 1
+		}
+		for j := 0; j < origins; j++ {
+			arc(&ins, "", 0, split)
+		}
+		if rnd.Intn(3) == 0 {
+			arc(&ins, "?", 0, placeCount)
+		}
+		if rnd.Intn(3) == 0 {
+			arc(&ins, "!", 0, placeCount)
+		}
+		if rnd.Intn(5) == 0 {
+			arc(&ins, "~", 0, placeCount)
+		}
+		used = map[string]bool{}
+		for j := rnd.Intn(3); j > 0; j-- {
+			if timed {
+				arc(&outs, "", 0, placeCount)
+			} else {
+				arc(&outs, "", split, placeCount)
+			}
+		}
+		if timed {
+			attrs = append(attrs, []string{"exp(1s)", "500ms..2s", "1s"}[rnd.Intn(3)])
+			if rnd.Intn(3) == 0 {
+				attrs = append(attrs, fmt.Sprintf("servers=%d", 1+rnd.Intn(2)))
+			}
+			attrs = append(attrs, "memory="+[]string{"enabling", "age", "resampling"}[rnd.Intn(3)])
+			if rnd.Intn(2) == 0 {
+				attrs = append(attrs, fmt.Sprintf("p=%d", rnd.Intn(3)))
+			}
+		} else {
+			attrs = append(attrs, fmt.Sprintf("p=%d", rnd.Intn(3)), fmt.Sprintf("w=%d", 1+rnd.Intn(3)))
+		}
+		if rnd.Intn(4) == 0 {
+			attrs = append(attrs, fmt.Sprintf("guard: %s + %s < %d", place(0, placeCount), place(0, placeCount), 2+rnd.Intn(4)))
+		}
+		line := fmt.Sprintf("[%s] \"t%d\"", strings.Join(attrs, ", "), i)
+		if len(ins) > 0 {
+			line = strings.Join(ins, ", ") + " -> " + line
+		}
+		if len(outs) > 0 {
+			line += " -> " + strings.Join(outs, ", ")
+		}
+		src.WriteString(line + "\n")
+	}
+	return src.String()
+}
+
+// timed transition should have as many events as it is enabled, at most as it has servers
+// those changed since last scheduling may have less, they are scheduled before time advances
+// enabled immediate transition has to be candidate
+func checkScheduling(sim *Simulation) error {
+	for _, tran := range sim.net.transitions {
+		enability := tran.getEnabilityMagnitude()
+		if tran.TimeFunc == nil {
+			if enability > 0 && !sim.candidates.has[tran] {
+				return fmt.Errorf("enabled immediate %s is not candidate", tran)
+			}
+			continue
+		}
+		if tran.Servers > 0 && enability > tran.Servers {
+			enability = tran.Servers
+		}
+		count := sim.calendar.count(tran)
+		if count > enability || count < enability && !sim.dirty.has[tran] {
+			return fmt.Errorf("%s has %d events, but it is %d times enabled", tran, count, enability)
+		}
+	}
+	return nil
+}
+
+/******* tests *******/
+
+// simulation re-evaluating only dependent transitions has to behave exactly
+// as simulation re-evaluating all transitions after every firing
+func TestDependenciesMatchFullEvaluation(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	for n := 0; n < 300; n++ {
+		src := generateRandomNet(rnd, 2+rnd.Intn(6), 1+rnd.Intn(8))
+		incremental, err := Parse(src)
+		if err != nil {
+			t.Fatalf("%s\n%s", err, src)
+		}
+		full, _ := Parse(src)
+		sim := NewSimulation(0, time.Minute, incremental)
+		sim.SetHistoryLimit(0)
+		fullSim := NewSimulation(0, time.Minute, full)
+		fullSim.SetHistoryLimit(0)
+		for _, tran := range fullSim.net.transitions {
+			fullSim.net.dependentsIn[tran] = fullSim.net.transitions
+			fullSim.net.dependentsOut[tran] = fullSim.net.transitions
+		}
+
+		for step := 0; step < 500; step++ {
+			tran, advance := sim.Step()
+			fullTran, fullAdvance := fullSim.Step()
+			if tran == nil || fullTran == nil {
+				if tran != nil || fullTran != nil {
+					t.Fatalf("net %d step %d: one simulation ended, fired %v and %v\n%s", n, step, tran, fullTran, src)
+				}
+				break
+			}
+			if tran.Description != fullTran.Description || advance != fullAdvance {
+				t.Fatalf("net %d step %d: fired %s after %s, full evaluation fired %s after %s\n%s",
+					n, step, tran.Description, advance, fullTran.Description, fullAdvance, src)
+			}
+			if err := checkScheduling(&sim); err != nil {
+				t.Fatalf("net %d step %d: %s\n%s", n, step, err, src)
+			}
+		}
+		if marking, fullMarking := incremental.places.String(), full.places.String(); marking != fullMarking {
+			t.Fatalf("net %d: final marking %s, full evaluation %s\n%s", n, marking, fullMarking, src)
+		}
+	}
+}
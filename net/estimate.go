@@ -0,0 +1,141 @@
+package net
+
+import (
+	"fmt"
+	"math"
+)
+
+/******* types *******/
+
+/* Estimate */
+
+// Estimate is mean of independent observations with its confidence interval
+type Estimate struct {
+	Mean float64
+	HalfWidth float64 // half width of confidence interval, infinite if there are less than 2 observations
+	Level float64 // confidence level, eg. 0.95
+	N int // count of observations
+}
+
+// NewEstimate computes mean of values and its confidence interval at given level
+// interval is based on Student's t distribution
+func NewEstimate(values []float64, level float64) Estimate {
+	e := Estimate{Level: level, N: len(values), HalfWidth: math.Inf(1)}
+	if e.N == 0 {
+		e.Mean = math.NaN()
+		return e
+	}
+	sum := 0.0
+	for _, value := range values {
+		sum += value
+	}
+	e.Mean = sum / float64(e.N)
+	if e.N < 2 {
+		return e
+	}
+	squares := 0.0
+	for _, value := range values {
+		squares += (value - e.Mean) * (value - e.Mean)
+	}
+	variance := squares / float64(e.N - 1)
+	df := float64(e.N - 1)
+	e.HalfWidth = studentQuantile((1 + level) / 2, df) * math.Sqrt(variance / float64(e.N))
+	return e
+}
+
+func (e Estimate) Low() float64 {
+	return e.Mean - e.HalfWidth
+}
+
+func (e Estimate) High() float64 {
+	return e.Mean + e.HalfWidth
+}
+
+func (e Estimate) String() string {
+	return fmt.Sprintf("%.4g ± %.3g", e.Mean, e.HalfWidth)
+}
+
+/******* unexported functions *******/
+
+// quantile of Student's t distribution with df degrees of freedom, found by bisection
+func studentQuantile(p, df float64) float64 {
+	if p <= 0 || p >= 1 {
+		return math.NaN()
+	}
+	if p < 0.5 {
+		return -studentQuantile(1 - p, df)
+	}
+	lo, hi := 0.0, 1.0
+	for studentCDF(hi, df) < p {
+		lo, hi = hi, hi * 2
+	}
+	for i := 0; i < 100 && hi - lo > 1e-12 * hi; i++ {
+		mid := (lo + hi) / 2
+		if studentCDF(mid, df) < p {
+			lo = mid
+		} else {
+			hi = mid
+		}
+	}
+	return (lo + hi) / 2
+}
+
+// cumulative distribution function of Student's t distribution
+func studentCDF(t, df float64) float64 {
+	tail := 0.5 * incompleteBeta(df / (df + t * t), df / 2, 0.5)
+	if t > 0 {
+		return 1 - tail
+	}
+	return tail
+}
+
+// regularized incomplete beta function I_x(a, b)
+func incompleteBeta(x, a, b float64) float64 {
+	if x <= 0 {
+		return 0
+	}
+	if x >= 1 {
+		return 1
+	}
+	lgab, _ := math.Lgamma(a + b)
+	lga, _ := math.Lgamma(a)
+	lgb, _ := math.Lgamma(b)
+	front := math.Exp(lgab - lga - lgb + a * math.Log(x) + b * math.Log(1 - x))
+	// continued fraction converges fast only for x below mean
+	if x < (a + 1) / (a + b + 2) {
+		return front * betaFraction(x, a, b) / a
+	}
+	return 1 - front * betaFraction(1 - x, b, a) / b
+}
+
+// continued fraction for incomplete beta function, evaluated by modified Lentz's method
+func betaFraction(x, a, b float64) float64 {
+	const eps = 1e-15
+	const tiny = 1e-300
+	nonzero := func(v float64) float64 {
+		if math.Abs(v) < tiny {
+			return tiny
+		}
+		return v
+	}
+	c := 1.0
+	d := 1 / nonzero(1 - (a + b) * x / (a + 1))
+	h := d
+	for m := 1.0; m <= 300; m++ {
+		// even step
+		num := m * (b - m) * x / ((a + 2*m - 1) * (a + 2*m))
+		d = 1 / nonzero(1 + num * d)
+		c = nonzero(1 + num / c)
+		h *= d * c
+		// odd step
+		num = -(a + m) * (a + b + m) * x / ((a + 2*m) * (a + 2*m + 1))
+		d = 1 / nonzero(1 + num * d)
+		c = nonzero(1 + num / c)
+		delta := d * c
+		h *= delta
+		if math.Abs(delta - 1) < eps {
+			break
+		}
+	}
+	return h
+}
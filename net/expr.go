@@ -0,0 +1,445 @@
+package net
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"unicode"
+)
+
+/******* types *******/
+
+/* Expr */
+
+// Expr is integer expression used in arc inscriptions and transition guards
+// boolean operators treat zero as false and anything else as true
+// and their result is 1 (true) or 0 (false)
+type Expr struct {
+	root exprNode
+}
+
+// Eval computes value of expression,
+// values of identifiers are provided by lookup function
+func (expr *Expr) Eval(lookup func(name string) (int, bool)) (int, error) {
+	return expr.root.eval(lookup)
+}
+
+// Idents returns names of all identifiers used in expression
+func (expr *Expr) Idents() []string {
+	names := []string{}
+	expr.root.walk(func(node exprNode) {
+		if id, ok := node.(identNode); ok {
+			names = append(names, string(id))
+		}
+	})
+	return names
+}
+
+// Ident returns name of identifier if whole expression is just one identifier
+func (expr *Expr) Ident() (string, bool) {
+	if expr == nil {
+		return "", false
+	}
+	id, ok := expr.root.(identNode)
+	return string(id), ok
+}
+
+// Places returns places whose number of tokens is used in expression
+func (expr *Expr) Places() Places {
+	places := Places{}
+	if expr == nil {
+		return places
+	}
+	expr.root.walk(func(node exprNode) {
+		if pl, ok := node.(placeNode); ok {
+			places.Push(pl.place)
+		}
+	})
+	return places
+}
+
+func (expr *Expr) String() string {
+	if expr == nil {
+		return ""
+	}
+	return expr.root.String()
+}
+
+/* expression nodes */
+
+type exprNode interface {
+	eval(lookup func(string) (int, bool)) (int, error)
+	walk(func(exprNode))
+	String() string
+}
+
+type numNode int
+
+type constNode struct { // named constant, eg. atom of colour set
+	name  string
+	value int
+}
+
+type identNode string
+
+type placeNode struct { // number of tokens in place
+	place *Place
+}
+
+type unaryNode struct {
+	op string
+	x  exprNode
+}
+
+type binaryNode struct {
+	op   string
+	x, y exprNode
+}
+
+func (n numNode) eval(func(string) (int, bool)) (int, error) {
+	return int(n), nil
+}
+
+func (n numNode) walk(fn func(exprNode)) {
+	fn(n)
+}
+
+func (n numNode) String() string {
+	return strconv.Itoa(int(n))
+}
+
+func (n constNode) eval(func(string) (int, bool)) (int, error) {
+	return n.value, nil
+}
+
+func (n constNode) walk(fn func(exprNode)) {
+	fn(n)
+}
+
+func (n constNode) String() string {
+	return n.name
+}
+
+func (n identNode) eval(lookup func(string) (int, bool)) (int, error) {
+	if lookup != nil {
+		if val, ok := lookup(string(n)); ok {
+			return val, nil
+		}
+	}
+	return 0, errors.New("unknown identifier `" + string(n) + "`")
+}
+
+func (n identNode) walk(fn func(exprNode)) {
+	fn(n)
+}
+
+func (n identNode) String() string {
+	return string(n)
+}
+
+func (n placeNode) eval(func(string) (int, bool)) (int, error) {
+	return n.place.Tokens, nil
+}
+
+func (n placeNode) walk(fn func(exprNode)) {
+	fn(n)
+}
+
+func (n placeNode) String() string {
+	return n.place.id
+}
+
+func (n unaryNode) eval(lookup func(string) (int, bool)) (int, error) {
+	x, err := n.x.eval(lookup)
+	if err != nil {
+		return 0, err
+	}
+	switch n.op {
+	case "-":
+		return -x, nil
+	case "!":
+		return boolToInt(x == 0), nil
+	}
+	return 0, errors.New("unknown operator " + n.op)
+}
+
+func (n unaryNode) walk(fn func(exprNode)) {
+	fn(n)
+	n.x.walk(fn)
+}
+
+func (n unaryNode) String() string {
+	if _, ok := n.x.(binaryNode); ok {
+		return n.op + "(" + n.x.String() + ")"
+	}
+	return n.op + n.x.String()
+}
+
+func (n binaryNode) eval(lookup func(string) (int, bool)) (int, error) {
+	x, err := n.x.eval(lookup)
+	if err != nil {
+		return 0, err
+	}
+	// short circuit
+	switch {
+	case n.op == "&&" && x == 0:
+		return 0, nil
+	case n.op == "||" && x != 0:
+		return 1, nil
+	}
+	y, err := n.y.eval(lookup)
+	if err != nil {
+		return 0, err
+	}
+	switch n.op {
+	case "+":
+		return x + y, nil
+	case "-":
+		return x - y, nil
+	case "*":
+		return x * y, nil
+	case "/", "%":
+		if y == 0 {
+			return 0, errors.New("division by zero in `" + n.String() + "`")
+		}
+		if n.op == "/" {
+			return x / y, nil
+		}
+		return x % y, nil
+	case "==":
+		return boolToInt(x == y), nil
+	case "!=":
+		return boolToInt(x != y), nil
+	case "<":
+		return boolToInt(x < y), nil
+	case "<=":
+		return boolToInt(x <= y), nil
+	case ">":
+		return boolToInt(x > y), nil
+	case ">=":
+		return boolToInt(x >= y), nil
+	case "&&", "||":
+		return boolToInt(y != 0), nil
+	}
+	return 0, errors.New("unknown operator " + n.op)
+}
+
+func (n binaryNode) walk(fn func(exprNode)) {
+	fn(n)
+	n.x.walk(fn)
+	n.y.walk(fn)
+}
+
+func (n binaryNode) String() string {
+	return wrapLower(n.x, n.op) + " " + n.op + " " + wrapLower(n.y, n.op)
+}
+
+// replaces identifiers for which place is found by number of tokens in that place
+func (expr *Expr) bindPlaces(find func(name string) (*Place, bool)) {
+	var bind func(node exprNode) exprNode
+	bind = func(node exprNode) exprNode {
+		switch n := node.(type) {
+		case identNode:
+			if place, ok := find(string(n)); ok {
+				return placeNode{place}
+			}
+		case unaryNode:
+			return unaryNode{n.op, bind(n.x)}
+		case binaryNode:
+			return binaryNode{n.op, bind(n.x), bind(n.y)}
+		}
+		return node
+	}
+	expr.root = bind(expr.root)
+}
+
+// copy of expression with places replaced according to given map, used by Net.Clone
+func (expr *Expr) replacePlaces(places map[*Place]*Place) *Expr {
+	if expr == nil {
+		return nil
+	}
+	var replace func(node exprNode) exprNode
+	replace = func(node exprNode) exprNode {
+		switch n := node.(type) {
+		case placeNode:
+			return placeNode{places[n.place]}
+		case unaryNode:
+			return unaryNode{n.op, replace(n.x)}
+		case binaryNode:
+			return binaryNode{n.op, replace(n.x), replace(n.y)}
+		}
+		return node
+	}
+	return &Expr{replace(expr.root)}
+}
+
+/******* exported functions *******/
+
+// ParseExpr parses expression like `x + 1` or `q > 2*k && !z`
+// identifiers found in consts are replaced by constant values
+func ParseExpr(input string, consts map[string]int) (*Expr, error) {
+	p := exprParser{tokens: tokenizeExpr(input), consts: consts}
+	if len(p.tokens) == 0 {
+		return nil, errors.New("empty expression")
+	}
+	root, err := p.parseBinary(0)
+	if err != nil {
+		return nil, err
+	}
+	if !p.done() {
+		return nil, fmt.Errorf("unexpected `%s` in expression `%s`", p.peek(), input)
+	}
+	return &Expr{root}, nil
+}
+
+/******* unexported *******/
+
+// binary operators by precedence, from lowest
+var exprOperators = [][]string{
+	{"||"},
+	{"&&"},
+	{"==", "!=", "<=", ">=", "<", ">"},
+	{"+", "-"},
+	{"*", "/", "%"},
+}
+
+func precedence(op string) int {
+	for prec, ops := range exprOperators {
+		for _, o := range ops {
+			if o == op {
+				return prec
+			}
+		}
+	}
+	return len(exprOperators)
+}
+
+// wraps node in parentheses if it binds weaker than op
+func wrapLower(node exprNode, op string) string {
+	if bin, ok := node.(binaryNode); ok && precedence(bin.op) <= precedence(op) {
+		return "(" + bin.String() + ")"
+	}
+	return node.String()
+}
+
+func boolToInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+func isTwoCharOperator(op string) bool {
+	switch op {
+	case "==", "!=", "<=", ">=", "&&", "||":
+		return true
+	}
+	return false
+}
+
+func tokenizeExpr(input string) []string {
+	tokens := []string{}
+	runes := []rune(input)
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_':
+			// identifier may contain dots, so places of module instances can be used, eg. `s1.busy`
+			isIdentStart := func(r rune) bool { return unicode.IsLetter(r) || r == '_' }
+			j := i
+			for j < len(runes) && (unicode.IsLetter(runes[j]) || unicode.IsDigit(runes[j]) || runes[j] == '_' ||
+				runes[j] == '.' && isIdentStart(r) && j+1 < len(runes) && isIdentStart(runes[j+1])) {
+				j++
+			}
+			tokens = append(tokens, string(runes[i:j]))
+			i = j
+		case i+1 < len(runes) && isTwoCharOperator(string(runes[i:i+2])):
+			tokens = append(tokens, string(runes[i:i+2]))
+			i += 2
+		default:
+			tokens = append(tokens, string(r))
+			i++
+		}
+	}
+	return tokens
+}
+
+type exprParser struct {
+	tokens []string
+	pos    int
+	consts map[string]int
+}
+
+func (p *exprParser) done() bool {
+	return p.pos >= len(p.tokens)
+}
+
+func (p *exprParser) peek() string {
+	if p.done() {
+		return ""
+	}
+	return p.tokens[p.pos]
+}
+
+func (p *exprParser) next() string {
+	tok := p.peek()
+	p.pos++
+	return tok
+}
+
+// precedence climbing
+func (p *exprParser) parseBinary(prec int) (exprNode, error) {
+	if prec == len(exprOperators) {
+		return p.parseUnary()
+	}
+	x, err := p.parseBinary(prec + 1)
+	if err != nil {
+		return nil, err
+	}
+	for !p.done() && precedence(p.peek()) == prec {
+		op := p.next()
+		y, err := p.parseBinary(prec + 1)
+		if err != nil {
+			return nil, err
+		}
+		x = binaryNode{op, x, y}
+	}
+	return x, nil
+}
+
+func (p *exprParser) parseUnary() (exprNode, error) {
+	tok := p.next()
+	switch {
+	case tok == "":
+		return nil, errors.New("unexpected end of expression")
+	case tok == "-" || tok == "!":
+		x, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return unaryNode{tok, x}, nil
+	case tok == "(":
+		x, err := p.parseBinary(0)
+		if err != nil {
+			return nil, err
+		}
+		if p.next() != ")" {
+			return nil, errors.New("missing `)` in expression")
+		}
+		return x, nil
+	case unicode.IsDigit(rune(tok[0])):
+		n, err := strconv.Atoi(tok)
+		if err != nil {
+			return nil, errors.New("invalid number `" + tok + "` in expression")
+		}
+		return numNode(n), nil
+	case unicode.IsLetter(rune(tok[0])):
+		if val, ok := p.consts[tok]; ok {
+			return constNode{tok, val}, nil
+		}
+		return identNode(tok), nil
+	}
+	return nil, errors.New("unexpected `" + tok + "` in expression")
+}
@@ -0,0 +1,68 @@
+package net
+
+import (
+	"time"
+)
+
+/******* types *******/
+
+/* Firing */
+
+// Firing is record of one fired transition
+type Firing struct {
+	Time time.Duration
+	Transition *Transition
+	Consumed Arcs // tokens removed by incomming and reset arcs, hidden self loop places are omitted
+	Produced Arcs // tokens added by outcomming arcs
+}
+
+// tokens in places of arcs
+func tokensOf(arcs Arcs) []int {
+	tokens := make([]int, len(arcs))
+	for i, arc := range arcs {
+		tokens[i] = arc.Place.Tokens
+	}
+	return tokens
+}
+
+// arcs weighted by how many tokens were moved since before,
+// sign is -1 for removed tokens and 1 for added
+// only visible places are included
+func moved(arcs Arcs, before []int, sign int, visible map[*Place]bool) Arcs {
+	diff := Arcs{}
+	seen := map[*Place]bool{}
+	for i, arc := range arcs {
+		if seen[arc.Place] || !visible[arc.Place] {
+			continue
+		}
+		seen[arc.Place] = true
+		if count := sign * (arc.Place.Tokens - before[i]); count > 0 {
+			diff.Push(count, arc.Place)
+		}
+	}
+	return diff
+}
+
+/******* simulation methods related to firing *******/
+
+// fires transition and records what it moved
+func (sim *Simulation) fireRecorded(tran *Transition) {
+	firing := Firing{Time: sim.now, Transition: tran}
+	in := append(append(Arcs{}, tran.Origins...), tran.Resets...)
+	before := tokensOf(in)
+	tran.doIn(sim.bindRands[tran])
+	firing.Consumed = moved(in, before, -1, sim.net.visible)
+	sim.update(sim.net.dependentsIn[tran])
+	before = tokensOf(tran.Targets)
+	tran.doOut()
+	firing.Produced = moved(tran.Targets, before, 1, sim.net.visible)
+	sim.update(sim.net.dependentsOut[tran])
+	sim.resample()
+	sim.firing(firing)
+}
+
+// DoEveryFiring sets function called after every fired transition
+// it is called while simulation is locked, so it must not call methods of simulation
+func (sim *Simulation) DoEveryFiring(fun func(Firing)) {
+	sim.firing = fun
+}
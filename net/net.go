@@ -1,11 +1,15 @@
 package net
 
 import (
+	"context"
+	"container/heap"
 	"fmt"
+	"hash/fnv"
 	"time"
 	"sort"
 	"strings"
 	"strconv"
+	"math/rand"
 )
 
 const MaxInt = int(^uint(0) >> 1)
@@ -17,10 +21,16 @@ const MaxInt = int(^uint(0) >> 1)
 type Net struct {
 	places Places
 	transitions Transitions
+	instances []*Instance
+	dependents map[*Place]Transitions // transitions whose enabling depends on place
+	dependentsIn map[*Transition]Transitions // transitions affected by doIn of transition
+	dependentsOut map[*Transition]Transitions // transitions affected by doOut of transition
+	order map[*Transition]int // position of transition in net
+	visible map[*Place]bool // places of net, hidden self loop places are not among them
 }
 
 func New(places Places, transitions Transitions) Net {
-	return Net{places, transitions}
+	return Net{places: places, transitions: transitions}
 }
 
 func (net *Net) Places() Places {
@@ -31,7 +41,78 @@ func (net *Net) Transitions() Transitions {
 	return net.transitions
 }
 
+// Instances returns instances of modules flattened into net
+func (net *Net) Instances() []*Instance {
+	return net.instances
+}
+
+// Clone returns deep copy of net with its current marking,
+// so it can be simulated independently of the original
+func (net Net) Clone() Net {
+	places := map[*Place]*Place{}
+	clonePlace := func(place *Place) *Place {
+		if copied, ok := places[place]; ok {
+			return copied
+		}
+		copied := *place
+		if place.Colours != nil {
+			copied.Values = place.Values.copy()
+			copied.initValues = place.initValues.copy()
+		}
+		places[place] = &copied
+		return &copied
+	}
+	clone := Net{}
+	for _, place := range net.places {
+		clone.places.Push(clonePlace(place))
+	}
+	cloneArcs := func(arcs Arcs) Arcs {
+		if arcs == nil {
+			return nil
+		}
+		cloned := make(Arcs, len(arcs))
+		for i, arc := range arcs {
+			cloned[i] = Arc{Weight: arc.Weight, Place: clonePlace(arc.Place), Inscription: arc.Inscription} // hidden self loop places are not in net
+		}
+		return cloned
+	}
+	transitions := map[*Transition]*Transition{}
+	for _, tran := range net.transitions {
+		copied := *tran
+		copied.Origins = cloneArcs(tran.Origins)
+		copied.Targets = cloneArcs(tran.Targets)
+		copied.Reads = cloneArcs(tran.Reads)
+		copied.Inhibitors = cloneArcs(tran.Inhibitors)
+		copied.Resets = cloneArcs(tran.Resets)
+		copied.Guard = tran.Guard.replacePlaces(places)
+		copied.binding = nil
+		transitions[tran] = &copied
+		clone.transitions = append(clone.transitions, &copied)
+	}
+	for _, instance := range net.instances {
+		copied := &Instance{Name: instance.Name, Module: instance.Module, Description: instance.Description}
+		for _, place := range instance.Ports {
+			copied.Ports.Push(places[place])
+		}
+		for _, place := range instance.Places {
+			copied.Places.Push(places[place])
+		}
+		for _, tran := range instance.Transitions {
+			copied.Transitions = append(copied.Transitions, transitions[tran])
+		}
+		clone.instances = append(clone.instances, copied)
+	}
+	return clone
+}
+
 func (net Net) String() (str string) {
+	colourSets := map[*ColourSet]bool{} // enumerations used by places, int is built-in
+	for _, pl := range net.places {
+		if pl.Colours != nil && pl.Colours.Atoms != nil && !colourSets[pl.Colours] {
+			colourSets[pl.Colours] = true
+			str += pl.Colours.String() + "\n"
+		}
+	}
 	for _, pl := range net.places {
 		str += pl.String() + "\n"
 	}
@@ -42,32 +123,134 @@ func (net Net) String() (str string) {
 	return
 }
 
+// builds index from places to transitions which have to be
+// reevaluated when number of tokens in place changes
+func (net *Net) indexDependencies() {
+	net.dependents = map[*Place]Transitions{}
+	net.order = map[*Transition]int{}
+	net.visible = map[*Place]bool{}
+	for _, place := range net.places {
+		net.visible[place] = true
+	}
+	for i, tran := range net.transitions {
+		net.order[tran] = i
+		places := map[*Place]bool{}
+		for _, arcs := range []Arcs{tran.Origins, tran.Reads, tran.Inhibitors} {
+			for _, arc := range arcs {
+				places[arc.Place] = true
+			}
+		}
+		for _, arc := range tran.Targets {
+			if arc.Place.Capacity > 0 { // tokens in target matter only if it can overflow
+				places[arc.Place] = true
+			}
+		}
+		for _, place := range tran.Guard.Places() {
+			places[place] = true
+		}
+		for place := range places {
+			net.dependents[place] = append(net.dependents[place], tran)
+		}
+	}
+	net.dependentsIn = map[*Transition]Transitions{}
+	net.dependentsOut = map[*Transition]Transitions{}
+	for _, tran := range net.transitions {
+		net.dependentsIn[tran] = net.dependentsOf(tran.Origins, tran.Resets)
+		net.dependentsOut[tran] = net.dependentsOf(tran.Targets)
+	}
+}
+
+// transitions depending on any of places of arcs, in order of net
+func (net *Net) dependentsOf(arcLists ...Arcs) Transitions {
+	seen := map[*Transition]bool{}
+	trans := Transitions{}
+	for _, arcs := range arcLists {
+		for _, arc := range arcs {
+			for _, tran := range net.dependents[arc.Place] {
+				if !seen[tran] {
+					seen[tran] = true
+					trans = append(trans, tran)
+				}
+			}
+		}
+	}
+	sort.Slice(trans, func(i, j int) bool { return net.order[trans[i]] < net.order[trans[j]] })
+	return trans
+}
+
 func (net *Net) saveState() {
 	for _, place := range net.places {
 		place.initTokens = place.Tokens
+		if place.Colours != nil {
+			place.initValues = place.Values.copy()
+		}
 	}
 }
 
 func (net *Net) restoreState() {
 	for _, place := range net.places {
 		place.Tokens = place.initTokens
+		if place.Colours != nil {
+			place.Values = place.initValues.copy()
+		}
 	}
 }
 
 
+/* Instance */
+
+// Instance of module, its places and transitions are part of net,
+// ids of its places are prefixed by name of instance, eg. `s1.busy`
+type Instance struct {
+	Name string
+	Module string
+	Description string
+	Ports Places // outer places bound to ports of module
+	Places Places // inner places, including those of nested instances
+	Transitions Transitions
+}
+
+
 /* Place */
 
 type Place struct {
 	Tokens int
+	Capacity int // maximal number of tokens, 0 means unlimited
+	Colours *ColourSet // nil for place with indistinguishable tokens
+	Values Multiset // values of tokens of coloured place, their count equals Tokens
 	Description string
 	id string
 	initTokens int
+	initValues Multiset
 }
 
 func (p Place) String () string {
+	if p.Colours != nil {
+		capacity := ""
+		if p.Capacity > 0 {
+			capacity = fmt.Sprintf("/%d", p.Capacity)
+		}
+		return fmt.Sprintf("%s:%s(%s%s)%s", p.id, p.Colours.Name, p.Values.format(p.Colours), capacity, p.Description)
+	}
+	if p.Capacity > 0 {
+		return fmt.Sprintf("%s(%d/%d)%s", p.id, p.Tokens, p.Capacity, p.Description)
+	}
 	return fmt.Sprintf("%s(%d)%s", p.id, p.Tokens, p.Description)
 }
 
+// Id is name of place used in penego notation
+func (p Place) Id() string {
+	return p.id
+}
+
+// how many more tokens can be put into place
+func (p *Place) freeSpace() int {
+	if p.Capacity == 0 {
+		return MaxInt
+	}
+	return p.Capacity - p.Tokens
+}
+
 
 /* Places */
 
@@ -91,13 +274,18 @@ func (places Places) String() string {
 type Arc struct {
 	Weight int
 	Place *Place
+	Inscription *Expr // value of tokens for coloured place
 }
 
 func (arc Arc) String() string {
+	str := arc.Place.id
+	if arc.Inscription != nil {
+		str += "(" + arc.Inscription.String() + ")"
+	}
 	if arc.Weight > 1 {
-		return fmt.Sprintf("%d*%s", arc.Weight, arc.Place.id)
+		return fmt.Sprintf("%d*%s", arc.Weight, str)
 	} else {
-		return arc.Place.id
+		return str
 	}
 }
 
@@ -114,31 +302,140 @@ func (arcs Arcs) String() string {
 }
 
 func (arcs *Arcs) Push(w int, place *Place) {
-	*arcs = append(*arcs, Arc{w, place})
+	*arcs = append(*arcs, Arc{Weight: w, Place: place})
+}
+
+/* Memory */
+
+// Memory is policy of timed transition
+type Memory int
+
+const (
+	EnablingMemory Memory = iota // scheduled time is forgotten when transition is disabled
+	AgeMemory // remaining time is remembered when transition is disabled and used when enabled again
+	ResamplingMemory // new time is drawn whenever any transition fires
+)
+
+func (memory Memory) String() string {
+	return map[Memory]string{
+		EnablingMemory: "enabling",
+		AgeMemory: "age",
+		ResamplingMemory: "resampling",
+	}[memory]
 }
 
+
 /* Transtition */
 
 type Transition struct {
 	Origins Arcs
 	Targets Arcs
+	Reads Arcs // transition requires at least Weight tokens in place, but does not consume them
+	Inhibitors Arcs // transition is disabled when place has at least Weight tokens
+	Resets Arcs // places emptied when transition fires, weight is ignored
 	Priority int
+	Weight float64 // relative probability of firing among conflicting immediate transitions, 0 means 1
 	TimeFunc *TimeFunc
+	Memory Memory // what happens with timing when transition is disabled or other fires
+	Servers int // how many firings of timed transition may run at once, 0 means infinite
+	Guard *Expr // condition over variables bound by inscriptions of origins and over marking
 	Description string
+	binding binding // used by last doIn
 }
 
 func (t Transition) String() string {
-	prio := ""
+	attrs := []string{}
+	if t.TimeFunc != nil {
+		attrs = append(attrs, t.TimeFunc.String())
+	}
 	if t.Priority != 0 {
-		prio = "p=" + strconv.Itoa(t.Priority)
+		attrs = append(attrs, "p=" + strconv.Itoa(t.Priority))
+	}
+	if t.Weight != 0 && t.Weight != 1 {
+		attrs = append(attrs, "w=" + strconv.FormatFloat(t.Weight, 'f', -1, 64))
+	}
+	if t.Servers != 0 {
+		attrs = append(attrs, "servers=" + strconv.Itoa(t.Servers))
+	}
+	if t.Memory != EnablingMemory {
+		attrs = append(attrs, "memory=" + t.Memory.String())
+	}
+	if t.Guard != nil {
+		attrs = append(attrs, "guard: " + t.Guard.String())
+	}
+	origins := make([]string, 0, len(t.Origins)+len(t.Reads)+len(t.Inhibitors)+len(t.Resets))
+	for _, arc := range t.Origins {
+		origins = append(origins, arc.String())
+	}
+	for _, arc := range t.Reads {
+		origins = append(origins, "?"+arc.String())
 	}
-	return fmt.Sprintf("%s -> [%s%s]%s -> %s", t.Origins, t.TimeFunc, prio, t.Description, t.Targets)
+	for _, arc := range t.Inhibitors {
+		origins = append(origins, "!"+arc.String())
+	}
+	for _, arc := range t.Resets {
+		origins = append(origins, "~"+arc.Place.id)
+	}
+	return fmt.Sprintf("%s -> [%s]%s -> %s", strings.Join(origins, ", "), strings.Join(attrs, ", "), t.Description, t.Targets)
+}
+
+// stable identity of transition used to key its random substreams,
+// hash of description and arcs, attributes like timing are left out
+func (t * Transition) streamKey() uint64 {
+	h := fnv.New64a()
+	fmt.Fprint(h, t.Description, t.Origins, t.Reads, t.Inhibitors, t.Resets, "->", t.Targets)
+	return h.Sum64()
+}
+
+func (t * Transition) getWeight() float64 {
+	if t.Weight == 0 {
+		return 1
+	}
+	return t.Weight
+}
+
+// whether all read arcs are satisfied
+func (t * Transition) canRead() bool {
+	for _, arc := range t.Reads {
+		if arc.Place.Tokens < arc.Weight {
+			return false
+		}
+	}
+	return true
+}
+
+func (t * Transition) isInhibited() bool {
+	for _, arc := range t.Inhibitors {
+		if arc.Place.Tokens >= arc.Weight {
+			return true
+		}
+	}
+	return false
+}
+
+// how many tokens transition takes from place
+func (t * Transition) consumes(place *Place) int {
+	for _, arc := range t.Resets {
+		if arc.Place == place {
+			return place.Tokens
+		}
+	}
+	for _, arc := range t.Origins {
+		if arc.Place == place {
+			return arc.Weight
+		}
+	}
+	return 0
 }
 
 /**
  * How many times can by transition fired with current marking on origins arcs
+ * and free space in targets places
  */
 func (t * Transition) getEnabilityMagnitude() int {
+	if t.isInhibited() || !t.canRead() {
+		return 0
+	}
 	enability := MaxInt
 	for _, arc := range t.Origins {
 		arcEnability := arc.Place.Tokens / arc.Weight // posible fires for this arc
@@ -146,30 +443,77 @@ func (t * Transition) getEnabilityMagnitude() int {
 			enability = arcEnability
 		}
 	}
+	for _, arc := range t.Targets {
+		if arc.Place.Capacity == 0 {
+			continue
+		}
+		growth := arc.Weight - t.consumes(arc.Place) // by one fire
+		if growth <= 0 {
+			continue
+		}
+		arcEnability := arc.Place.freeSpace() / growth
+		if arcEnability < enability {
+			enability = arcEnability
+		}
+	}
+	if enability > 0 && t.needsBinding() {
+		enability = t.getBindingMagnitude(enability)
+	}
 	return enability
 }
 
 func (t * Transition) isEnabled() bool {
+	if t.isInhibited() || !t.canRead() {
+		return false
+	}
 	for _, arc := range t.Origins {
 		if arc.Place.Tokens < arc.Weight {
 			return false
 		}
 	}
+	for _, arc := range t.Targets {
+		if arc.Weight - t.consumes(arc.Place) > arc.Place.freeSpace() {
+			return false
+		}
+	}
+	if t.needsBinding() {
+		_, ok := t.findBinding(nil)
+		return ok
+	}
 	return true
 }
 
-func (t * Transition) doIn() {
+// rnd chooses binding, without it the first one in ascending order of values is used
+func (t * Transition) doIn(rnd *rand.Rand) {
+	if t.needsBinding() {
+		b, ok := t.findBinding(rnd)
+		if !ok {
+			panic("impossible transition done")
+		}
+		t.takeValues(b)
+		t.binding = b
+	}
 	for _, arc := range t.Origins {
 		arc.Place.Tokens -= arc.Weight
 		if arc.Place.Tokens < 0 {
 			panic("impossible transition done")
 		}
 	}
+	for _, arc := range t.Resets {
+		arc.Place.Tokens = 0
+		if arc.Place.Colours != nil {
+			arc.Place.Values = Multiset{}
+		}
+	}
 }
 
 func (t * Transition) doOut() {
+	t.putValues(t.binding)
 	for _, arc := range t.Targets {
 		arc.Place.Tokens += arc.Weight
+		if arc.Place.Capacity > 0 && arc.Place.Tokens > arc.Place.Capacity {
+			panic("impossible transition done")
+		}
 	}
 }
 
@@ -186,25 +530,31 @@ func (trans *Transitions) Remove(i int) {
 	*trans = append((*trans)[:i], (*trans)[i+1:]...)
 }
 
-/* following 3 methods are implemented to satisfy sort.Interface */
-func (trans Transitions) Len() int {
-	return len(trans)
-}
-
-func (trans Transitions) Swap(i, j int) {
-	trans[i], trans[j] = trans[j], trans[i]
-}
-
-func (trans Transitions) Less(i, j int) bool {
-	// timed have always lower priority
-	if trans[i].TimeFunc == nil && trans[j].TimeFunc != nil {
-		return true
+// pickWeighted randomly chooses one of enabled immediate transitions with given priority
+// probability of being chosen is proportional to transition's weight
+func (trans Transitions) pickWeighted(priority int, rnd *rand.Rand) *Transition {
+	candidates := Transitions{}
+	sum := 0.0
+	for _, tran := range trans {
+		if tran.TimeFunc == nil && tran.Priority == priority && tran.isEnabled() {
+			candidates = append(candidates, tran)
+			sum += tran.getWeight()
+		}
 	}
-	if trans[j].TimeFunc == nil && trans[i].TimeFunc != nil {
-		return false
+	switch len(candidates) {
+	case 0:
+		return nil
+	case 1:
+		return candidates[0] // no conflict, no random number drawn
+	}
+	r := rnd.Float64() * sum
+	for _, tran := range candidates {
+		r -= tran.getWeight()
+		if r < 0 {
+			return tran
+		}
 	}
-	// if both or niether are timed copmpare priority
-	return trans[i].Priority > trans[j].Priority
+	return candidates[len(candidates)-1]
 }
 
 
@@ -213,54 +563,145 @@ func (trans Transitions) Less(i, j int) bool {
 type Event struct {
 	time time.Duration
 	transition *Transition
+	seq uint64 // order of insertion
+	index int // position in heap
+}
+
+// whether event e occurs before other
+// events of the same time go immediate first, then by priority, then by order of insertion
+func (e *Event) before(other *Event) bool {
+	if e.time != other.time {
+		return e.time < other.time
+	}
+	eImmediate, otherImmediate := e.transition.TimeFunc == nil, other.transition.TimeFunc == nil
+	if eImmediate != otherImmediate {
+		return eImmediate
+	}
+	if e.transition.Priority != other.transition.Priority {
+		return e.transition.Priority > other.transition.Priority
+	}
+	return e.seq < other.seq
 }
 
 
 /* Calendar */
 
-type Calendar []Event
+// Calendar is priority queue of scheduled events
+// with index of events by transition, so they can be counted and canceled fast
+type Calendar struct {
+	events eventHeap
+	byTransition map[*Transition][]*Event
+	seq uint64
+}
+
+func newCalendar() Calendar {
+	return Calendar{
+		events: eventHeap{},
+		byTransition: map[*Transition][]*Event{},
+	}
+}
 
 func (c Calendar) String() string {
+	events := append(eventHeap{}, c.events...)
+	sort.Slice(events, func(i, j int) bool { return events[i].before(events[j]) })
 	str := "c: "
-	for _, event := range c {
+	for _, event := range events {
 		str += fmt.Sprintf("T=%s,%s | ", event.time, event.transition.Description)
 	}
 	return str
 }
 
-func (c *Calendar) Insert(event Event, i int) {
-	*c = append((*c)[:i], append([]Event{event}, (*c)[i:]...)...)
+func (c *Calendar) Len() int {
+	return len(c.events)
 }
 
-func (c *Calendar) Remove(i int) {
-	*c = append((*c)[:i], (*c)[i+1:]...)
+func (c *Calendar) isEmpty() bool {
+	return len(c.events) == 0
 }
 
-func (c *Calendar) isEmpty() bool {
-	return len(*c) == 0
+// count of scheduled events of transition
+func (c *Calendar) count(tran *Transition) int {
+	return len(c.byTransition[tran])
+}
+
+// time of first event
+func (c *Calendar) peek() time.Duration {
+	return c.events[0].time
 }
 
+// removes and returns first event
 func (c *Calendar) shift() (time.Duration, *Transition) {
-	defer func() {
-		*c = (*c)[1:]
-	}()
-	return (*c)[0].time, (*c)[0].transition
+	event := heap.Pop(&c.events).(*Event)
+	c.unindex(event)
+	return event.time, event.transition
 }
 
 func (c *Calendar) insertByTime(newTime time.Duration, tran *Transition) {
-	if c.isEmpty() {
-		c.Insert(Event{newTime, tran}, 0)
-		return
+	c.seq++
+	event := &Event{time: newTime, transition: tran, seq: c.seq}
+	heap.Push(&c.events, event)
+	c.byTransition[tran] = append(c.byTransition[tran], event)
+}
+
+// removes event of transition which would occur last, returns its time
+func (c *Calendar) removeLatest(tran *Transition) time.Duration {
+	events := c.byTransition[tran]
+	if len(events) == 0 {
+		return 0
 	}
-	i, event := 0, Event{}
-	for i, event = range *c {
-		if newTime < event.time {
-			c.Insert(Event{newTime, tran}, i)
-			return
+	latest := events[0]
+	for _, event := range events[1:] {
+		if latest.before(event) {
+			latest = event
+		}
+	}
+	heap.Remove(&c.events, latest.index)
+	c.unindex(latest)
+	return latest.time
+}
+
+func (c *Calendar) unindex(event *Event) {
+	events := c.byTransition[event.transition]
+	for i, e := range events {
+		if e == event {
+			events[i] = events[len(events)-1]
+			events = events[:len(events)-1]
+			break
 		}
 	}
-	// not found, new is biggest
-	c.Insert(Event{newTime, tran}, i+1)
+	c.byTransition[event.transition] = events // empty is kept, to be reused
+}
+
+/* eventHeap */
+
+type eventHeap []*Event
+
+/* following 5 methods are implemented to satisfy heap.Interface */
+func (h eventHeap) Len() int {
+	return len(h)
+}
+
+func (h eventHeap) Less(i, j int) bool {
+	return h[i].before(h[j])
+}
+
+func (h eventHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *eventHeap) Push(x interface{}) {
+	event := x.(*Event)
+	event.index = len(*h)
+	*h = append(*h, event)
+}
+
+func (h *eventHeap) Pop() interface{} {
+	old := *h
+	event := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return event
 }
 
 
@@ -273,12 +714,75 @@ type Simulation struct {
 	net Net
 	calendar Calendar
 	stateChange func(time.Duration, time.Duration)
-	paused bool
-	stopped bool
+	firing func(Firing) // nil if firings are not recorded
+	control *control // shared by copies of simulation
+	seed int64
+	rand *rand.Rand // for conflicts of immediate transitions
+	rands map[*Transition]*rand.Rand // substreams of transitions used for timing
+	bindRands map[*Transition]*rand.Rand // substreams of transitions used for choice of binding
+	dirty transitionSet // transitions affected by firings since last scheduling
+	candidates transitionSet // immediate transitions which may be enabled
+	remaining map[*Transition][]time.Duration // remembered times of transitions with age memory
+	resampled Transitions // transitions with resampling memory
+	collector collector // statistics since warm-up
+	resources map[*Place]bool // places chosen by SetResources
+	warmUp time.Duration
+	warmedUp bool
+	batchCount int
+	batch *collector // statistics of current batch, nil if there are no batches
+	batches []Statistics // completed batches
+	started bool // whether simulation was initialized by Run or Step
+	reason StopReason
+	conditions []StopCondition
+	holds []func(*Simulation, *Transition) bool // bound conditions
+	met int // index of condition which ended simulation
+	firings int // count of all firings since start
+	passes int // count of immediate firings at current time
+	history []snapshot // states before steps, for StepBack
+	historyLimit int
+}
+
+/* transitionSet */
+
+// set of transitions kept in order of net, so simulation is reproducible
+type transitionSet struct {
+	list Transitions
+	has map[*Transition]bool
+	order map[*Transition]int
+}
+
+func newTransitionSet(order map[*Transition]int) transitionSet {
+	return transitionSet{Transitions{}, map[*Transition]bool{}, order}
+}
+
+func (set *transitionSet) add(tran *Transition) {
+	if set.has[tran] {
+		return
+	}
+	set.has[tran] = true
+	i := len(set.list)
+	set.list = append(set.list, tran)
+	for ; i > 0 && set.order[set.list[i-1]] > set.order[tran]; i-- {
+		set.list[i] = set.list[i-1]
+	}
+	set.list[i] = tran
+}
+
+// keeps only transitions for which keep returns true
+func (set *transitionSet) filter(keep func(*Transition) bool) {
+	list := set.list[:0]
+	for _, tran := range set.list {
+		if keep(tran) {
+			list = append(list, tran)
+		} else {
+			set.has[tran] = false
+		}
+	}
+	set.list = list
 }
 
-func (sim *Simulation) GetNow() time.Duration {
-	return sim.now
+func (set *transitionSet) clear() {
+	set.filter(func(*Transition) bool { return false })
 }
 
 /**
@@ -289,139 +793,208 @@ func (sim *Simulation) GetNow() time.Duration {
  */
 func (sim *Simulation) diffEnabilityVsScheduled(transition *Transition) int {
 	enability := transition.getEnabilityMagnitude()
-	eventCount := 0
-	for _, event := range sim.calendar {
-		if event.transition == transition {
-			eventCount++
-		}
+	if transition.Servers > 0 && enability > transition.Servers {
+		enability = transition.Servers // the rest waits for free server
 	}
-	return enability - eventCount
+	return enability - sim.calendar.count(transition)
 }
 
+// schedules events of timed transitions affected since last scheduling
 func (sim *Simulation) scheduleEnabledTimed() {
-	for _, tran := range sim.net.transitions {
+	for _, tran := range sim.dirty.list {
 		if tran.TimeFunc != nil {
 			max := sim.diffEnabilityVsScheduled(tran) // how many times schedule
 			for i := 0; i < max; i++ {
-				sim.calendar.insertByTime(sim.now + (*tran.TimeFunc)(), tran)
+				sim.calendar.insertByTime(sim.now + sim.delay(tran), tran)
 			}
 		}
 	}
+	sim.dirty.clear()
 }
 
-func (sim *Simulation) cancelUnenabledTimed() {
-	subtractions := map[*Transition]int{}
-	for _, tran := range sim.net.transitions {
-		subtractions[tran] = sim.diffEnabilityVsScheduled(tran)
+// delay of new event, remembered remaining time is used first
+func (sim *Simulation) delay(tran *Transition) time.Duration {
+	if remaining := sim.remaining[tran]; len(remaining) > 0 {
+		sim.remaining[tran] = remaining[:len(remaining)-1]
+		return remaining[len(remaining)-1]
 	}
-
-	// remove excess
-	for i := len(sim.calendar)-1; i >= 0; i-- { // TODO go through in random order each time
-		tran := sim.calendar[i].transition
-		if sub, ok := subtractions[tran]; ok && sub < 0 {
-			sim.calendar.Remove(i)
-			subtractions[tran]++
+	return (*tran.TimeFunc)(sim.rands[tran])
+}
+
+// cancels events of transitions which are no longer enabled
+// and marks transitions to be checked again
+func (sim *Simulation) update(trans Transitions) {
+	for _, tran := range trans {
+		// remove excess, latest events first
+		for sub := sim.diffEnabilityVsScheduled(tran); sub < 0; sub++ {
+			eventTime := sim.calendar.removeLatest(tran)
+			if tran.Memory == AgeMemory {
+				sim.remaining[tran] = append(sim.remaining[tran], eventTime - sim.now)
+			}
+		}
+		sim.dirty.add(tran)
+		if tran.TimeFunc == nil {
+			sim.candidates.add(tran)
 		}
 	}
 }
 
-func (sim *Simulation) DoEveryStateChange(fun func(time.Duration, time.Duration)) {
-	sim.stateChange = func(now, then time.Duration) {
-		if fun != nil {
-			fun(now, then)
+// all transitions have to be checked, eg. at start
+func (sim *Simulation) updateAll() {
+	sim.dirty = newTransitionSet(sim.net.order)
+	sim.candidates = newTransitionSet(sim.net.order)
+	sim.remaining = map[*Transition][]time.Duration{}
+	sim.resampled = Transitions{}
+	for _, tran := range sim.net.transitions {
+		if tran.TimeFunc != nil && tran.Memory == ResamplingMemory {
+			sim.resampled = append(sim.resampled, tran)
 		}
 	}
+	sim.update(sim.net.transitions)
 }
 
-// Run starts running simulation or continue in running from previously paused state
-func (sim *Simulation) Run() {
-
-	if !sim.paused {
-		restartSeed()
-		sim.now = sim.startTime
-		sim.calendar = Calendar{}
-	} // else use previously used values
+// cancels all events of transitions with resampling memory, so they are scheduled again
+func (sim *Simulation) resample() {
+	for _, tran := range sim.resampled {
+		for sim.calendar.count(tran) > 0 {
+			sim.calendar.removeLatest(tran)
+		}
+		sim.dirty.add(tran)
+	}
+}
 
-	sim.paused = false
-	sim.stopped = false
+// fire does transition and cancels scheduled events which are no longer enabled
+// only transitions depending on changed places are checked
+func (sim *Simulation) fire(tran *Transition) {
+	if sim.firing != nil {
+		sim.fireRecorded(tran)
+	} else {
+		tran.doIn(sim.bindRands[tran])
+		sim.update(sim.net.dependentsIn[tran])
+		tran.doOut()
+		sim.update(sim.net.dependentsOut[tran]) // new tokens may disable too (inhibitors, capacities)
+		sim.resample()
+	}
+	sim.collector.fired(tran, sim.now)
+	if sim.batch != nil {
+		sim.batch.fired(tran, sim.now)
+	}
+}
 
-	sortedTransitions := make(Transitions, len(sim.net.transitions))
-	copy(sortedTransitions, sim.net.transitions)
-	sort.Sort(sortedTransitions)
+// nextImmediate chooses enabled immediate transition with the highest priority
+// conflicts of the same priority are resolved by weights
+func (sim *Simulation) nextImmediate() *Transition {
+	sim.candidates.filter((*Transition).isEnabled) // disabled stay so until their places change
+	if len(sim.candidates.list) == 0 {
+		return nil
+	}
+	priority := sim.candidates.list[0].Priority
+	for _, tran := range sim.candidates.list {
+		if tran.Priority > priority {
+			priority = tran.Priority
+		}
+	}
+	return sim.candidates.list.pickWeighted(priority, sim.rand)
+}
 
-	fireEvent := func(scheduledTran *Transition, before, now time.Duration) {
+// SetSeed sets seed of pseudo random generators used by simulation
+// the same seed is used at beginning of every Run, so runs are reproducible
+func (sim *Simulation) SetSeed(seed int64) {
+	sim.seed = seed
+}
 
-		scheduledTran.doIn()
-		sim.cancelUnenabledTimed()
-		scheduledTran.doOut()
-		sim.stateChange(before, now)
+// each transition gets its own independent substreams for timing and for bindings,
+// they are keyed by transition's description and arcs, not by its position in net,
+// so change, addition or removal of one transition does not affect samples of others
+func (sim *Simulation) restartRand() {
+	sim.rand = rand.New(rand.NewSource(sim.seed))
+	sim.rands = map[*Transition]*rand.Rand{}
+	sim.bindRands = map[*Transition]*rand.Rand{}
+	occurrences := map[uint64]uint64{} // identical transitions get different substreams too
+	for _, tran := range sim.net.transitions {
+		key := tran.streamKey()
+		seed := substreamSeed(sim.seed, key + occurrences[key])
+		occurrences[key]++
+		sim.rands[tran] = rand.New(rand.NewSource(seed))
+		sim.bindRands[tran] = rand.New(rand.NewSource(substreamSeed(seed, 0)))
+	}
+}
 
-		countOfPasses := 0
-		stabilize: // whenever transition is completed, start checking again from bigest priority
-		countOfPasses++
-		if countOfPasses > 1E3 {
-			panic("too many transitions done in same time, possible loop")
-		}
-		for _, tran := range sortedTransitions { // TODO cycle transitions with same priority in random order
-			if tran.TimeFunc != nil {
-				break // no need to go further, rest are timed due to sort
-			}
-			if sim.stopped {
-				return
-			}
-			if tran.isEnabled() {
-				if sim.paused {
-					sim.calendar.Insert(Event{now, tran}, 0)
-					return
-				}
-				tran.doIn()
-				sim.cancelUnenabledTimed()
-				tran.doOut()
-				sim.stateChange(now, now)
-				goto stabilize
-			}
+func (sim *Simulation) DoEveryStateChange(fun func(time.Duration, time.Duration)) {
+	sim.stateChange = func(now, then time.Duration) {
+		if fun != nil {
+			fun(now, then)
 		}
+	}
+}
 
-		sim.scheduleEnabledTimed() // might create new event in current time
+// Run runs simulation until end time is reached, there are no more events,
+// simulation is stopped or ctx is canceled
+// it continues from state left by Step, otherwise it starts from beginning
+// while simulation is paused, Run blocks
+func (sim *Simulation) Run(ctx context.Context) {
+	if sim.control == nil || !sim.control.start() {
+		return // zero Simulation or already running
 	}
+	defer sim.control.finish(sim.reset)
+
+	done := make(chan struct{})
+	defer close(done)
+	go func() { // paused Run must notice canceled context
+		select {
+		case <-ctx.Done():
+			sim.control.wake()
+		case <-done:
+		}
+	}()
 
-	fireEvent(&Transition{}, sim.startTime, sim.startTime) // todo schedule empty tarn instead?
+	if !sim.started {
+		sim.control.locked(func() {
+			sim.init()
+			sim.publish()
+		})
+		sim.stateChange(sim.startTime, sim.startTime)
+	}
 
-	for !sim.calendar.isEmpty() {
-		if sim.paused  {
-			return
-		}
-		if sim.stopped {
-			break
+	for sim.control.proceed(ctx) {
+		var tran *Transition
+		var advance time.Duration
+		sim.control.locked(func() { // statistics can be read meanwhile
+			sim.history = sim.history[:0] // steps done by Run can not be undone
+			tran, advance = sim.step()
+			sim.publish()
+		})
+		if tran == nil {
+			return // reason is set by step
 		}
-		eventTime, tranToFireNow := sim.calendar.shift()
-		if eventTime > sim.endTime {
-			break
+		sim.stateChange(sim.now - advance, sim.now) // previous time and time of event
+		if sim.reason == ConditionMet {
+			return
 		}
-		before := sim.now
-		sim.now = eventTime
-		fireEvent(tranToFireNow, before, sim.now)  // current time and time of event
 	}
-}
-
-// Pause pauses current simulation Run
-// Intended to be called simultaneously with simulation.Run
-func (sim *Simulation) Pause() {
-	sim.paused = true
-	sim.stopped = false
-}
-
-func (sim *Simulation) Stop() {
-	if sim.paused {
-		sim.paused = false
-	}
-	sim.net.restoreState()
-	sim.stopped = true
+	sim.control.locked(func() {
+		if ctx.Err() != nil {
+			sim.reason = Canceled
+		} else {
+			sim.reason = Stopped
+		}
+		sim.publish()
+	})
 }
 
 /******* exported functions *******/
 
 func NewSimulation(startTime, endTime time.Duration, net Net) Simulation {
 	net.saveState()
-	return Simulation{startTime, endTime, 0, net, Calendar{}, nil, false, false}
+	net.indexDependencies()
+	return Simulation{
+		startTime: startTime,
+		endTime: endTime,
+		net: net,
+		calendar: newCalendar(),
+		stateChange: func(time.Duration, time.Duration) {},
+		control: newControl(),
+		seed: DefaultSeed,
+		historyLimit: DefaultHistoryLimit,
+	}
 }
\ No newline at end of file
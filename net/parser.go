@@ -1,6 +1,8 @@
 package net
 
 import (
+	"fmt"
+	"path/filepath"
 	"regexp"
 	"strings"
 	"strconv"
@@ -9,11 +11,44 @@ import (
 )
 
 
+// prefixes of special incoming arcs
+// `!` inhibitor
+// `~` reset
+// `?` read
+const arcKinds = `!~?`
+
+// limits instantiation of modules within modules, so recursion is detected
+const maxModuleDepth = 16
+
 var (
+	colsetRE *regexp.Regexp
 	placeRE *regexp.Regexp
 	transitionRE *regexp.Regexp
 	emptyLineRE *regexp.Regexp
 	timeRE *regexp.Regexp
+	tokenRE *regexp.Regexp
+	arcRE *regexp.Regexp
+	// modules
+	moduleRE *regexp.Regexp
+	moduleEndRE *regexp.Regexp
+	instanceRE *regexp.Regexp
+	// transition attributes
+	prioRE *regexp.Regexp
+	weightRE *regexp.Regexp
+	memoryRE *regexp.Regexp
+	serversRE *regexp.Regexp
+	fixRE *regexp.Regexp
+	unifRE *regexp.Regexp
+	expRE *regexp.Regexp
+	erlRE *regexp.Regexp
+	normRE *regexp.Regexp
+	lognormRE *regexp.Regexp
+	triRE *regexp.Regexp
+	weibRE *regexp.Regexp
+	gammaRE *regexp.Regexp
+	hyperRE *regexp.Regexp
+	empirRE *regexp.Regexp
+	guardRE *regexp.Regexp
 )
 
 func init () {
@@ -24,9 +59,17 @@ func init () {
 		NUM = `(0|([1-9][0-9]*))`
 		STR = `"[^"]*"`
 		CMNT = `((//)|(--)).*`
-		ARC = SP+`(`+NUM+SP+`\*`+SP+`)?`+ID+SP
+		ARCKIND = `[`+arcKinds+`]`
+		INSCR = `[^()\[\],]*(\([^()\[\],]*\)[^()\[\],]*)*` // without commas, one level of parentheses
+		ARC = SP+`(`+NUM+SP+`\*`+SP+`)?`+ID+SP+`(\(`+INSCR+`\))?`+SP
 		ARCS = ARC+`(,`+ARC+`)*`
+		INARC = SP+`(`+ARCKIND+SP+`)?`+ARC
+		INARCS = INARC+`(,`+INARC+`)*`
+		FLOAT = `(([0-9]+(\.[0-9]*)?)|(\.[0-9]+))`
 		PRIO = `p=(?P<prio>`+NUM+`)`
+		WEIGHT = `w=(?P<weight>`+FLOAT+`)`
+		SERVERS = `servers=(?P<servers>`+NUM+`|inf)`
+		MEMORY = `memory=(?P<memory>enabling|age|resampling)`
 		TIME = `(?P<t>`+NUM+`)(?P<u>[smhd]|(ms)|(us))?`
 		FIX = `(`+TIME+`)`
 		UNIF0 = `(?P<from>`+TIME+`)(-|(..))(?P<to>`+TIME+`)`
@@ -34,18 +77,45 @@ func init () {
 		UNIF = `(` + UNIF0 + `|` + UNIF1 + `)`
 		EXP = `exp\((?P<mean>`+TIME+`)\)`
 		ERL = `erlang\((?P<k>`+NUM+`),(?P<mean>`+TIME+`)\)`
-		ATTR = `(`+PRIO+`)|(?P<fix>`+FIX+`)|(?P<unif>`+UNIF+`)|(?P<exp>`+EXP+`)|(?P<erl>`+ERL+`)`
+		NORM = `normal\((?P<mean>`+TIME+`),(?P<sd>`+TIME+`)\)`
+		LOGNORM = `lognormal\((?P<mean>`+TIME+`),(?P<sd>`+TIME+`)\)`
+		TRI = `triangular\((?P<min>`+TIME+`),(?P<mode>`+TIME+`),(?P<max>`+TIME+`)\)`
+		WEIB = `weibull\((?P<k>`+FLOAT+`),(?P<scale>`+TIME+`)\)`
+		GAMMA = `gamma\((?P<k>`+FLOAT+`),(?P<scale>`+TIME+`)\)`
+		EMPIR = `empirical\((?P<file>`+STR+`)(,`+SP+`(?P<mode>step|linear))?\)`
+		HYPER = `hyperexp\((?P<phases>`+FLOAT+`,`+TIME+`(,`+FLOAT+`,`+TIME+`)*)\)`
+		GUARD = `guard:`+SP+`(?P<expr>.+)`
+		ATTRS = `[^\[\]]*`
+		IDS = ID+`(`+SP+`,`+SP+ID+`)*`
+		VALUE = `(-?`+NUM+`)|(`+ID+`)`
+		TOKEN = `(`+NUM+SP+`\*`+SP+`)?(`+VALUE+`)`
+		TOKENS = TOKEN+`(`+SP+`,`+SP+TOKEN+`)*`
 	)
 
 
 	/** prepare regexps strings **/
 
-	// ID ( NUM? ) STR?
+	// colset ID = { ID, ID... }
+	colsetREstr := strings.Join([]string{
+		`^`,
+		`colset`,
+		`(?P<name>`+ID+`)`,
+		`=`,
+		`\{`,
+		`(?P<atoms>`+ID+`(`+SP+`,`+SP+ID+`)*)`,
+		`\}`,
+		`(`+CMNT+`)?`,
+		`$`,
+	}, SP)
+
+	// ID (: ID)? ( TOKENS? (/ NUM)? ) STR?
 	placeREstr := strings.Join([]string{
 		`^`,
 		`(?P<id>`+ID+`)`,
+		`(:`+SP+`(?P<colset>`+ID+`))?`,
 		`\(`,
-		`(?P<num>`+NUM+`)?`,
+		`(?P<num>`+TOKENS+`)?`,
+		`(/`+SP+`(?P<cap>`+NUM+`))?`,
 		`\)`,
 		`(?P<desc>`+STR+`)?`,
 		`(`+CMNT+`)?`,
@@ -55,9 +125,9 @@ func init () {
 	// IDS -> [ ATTR? ] STR? -> IDS
 	transitionREstr := strings.Join([]string{
 		`^`,
-		`((?P<in>`+ARCS+`)->)?`,
+		`((?P<in>`+INARCS+`)->)?`,
 		`\[`,	// [
-		`(?P<attr>`+ATTR+`)?`,
+		`(?P<attr>`+ATTRS+`)`,
 		`\]`,	// ]
 		`(?P<desc>`+STR+`)?`,
 		`(->(?P<out>`+ARCS+`))?`,
@@ -65,57 +135,332 @@ func init () {
 		`$`,
 	}, SP)
 
+	// module ID ( IDS? ) {
+	moduleREstr := strings.Join([]string{
+		`^`,
+		`module`,
+		`(?P<name>`+ID+`)`,
+		`\(`,
+		`(?P<ports>`+IDS+`)?`,
+		`\)`,
+		`\{`,
+		`(`+CMNT+`)?`,
+		`$`,
+	}, SP)
+
+	// ID = ID ( IDS? ) STR?
+	instanceREstr := strings.Join([]string{
+		`^`,
+		`(?P<name>`+ID+`)`,
+		`=`,
+		`(?P<module>`+ID+`)`,
+		`\(`,
+		`(?P<args>`+IDS+`)?`,
+		`\)`,
+		`(?P<desc>`+STR+`)?`,
+		`(`+CMNT+`)?`,
+		`$`,
+	}, SP)
+
 	/** compile regexps **/
 
+	colsetRE = regexp.MustCompile(colsetREstr)
 	placeRE = regexp.MustCompile(placeREstr)
 	transitionRE = regexp.MustCompile(transitionREstr)
+	moduleRE = regexp.MustCompile(moduleREstr)
+	moduleEndRE = regexp.MustCompile(`^\}`+SP+`(`+CMNT+`)?$`)
+	instanceRE = regexp.MustCompile(instanceREstr)
 	emptyLineRE = regexp.MustCompile(`^`+SP+`(`+CMNT+`)?$`)
 	timeRE = regexp.MustCompile(TIME)
+	tokenRE = regexp.MustCompile(`^((?P<w>`+NUM+`)`+SP+`\*)?`+SP+`(?P<value>`+VALUE+`)$`)
+	arcRE = regexp.MustCompile(`^((?P<w>`+NUM+`)`+SP+`\*)?`+SP+`(?P<id>`+ID+`)`+SP+`(\((?P<inscr>.*)\))?$`)
+
+	prioRE = regexp.MustCompile(`^`+PRIO+`$`)
+	weightRE = regexp.MustCompile(`^`+WEIGHT+`$`)
+	memoryRE = regexp.MustCompile(`^`+MEMORY+`$`)
+	serversRE = regexp.MustCompile(`^`+SERVERS+`$`)
+	fixRE = regexp.MustCompile(`^`+FIX+`$`)
+	unifRE = regexp.MustCompile(`^`+UNIF+`$`)
+	expRE = regexp.MustCompile(`^`+EXP+`$`)
+	erlRE = regexp.MustCompile(`^`+ERL+`$`)
+	normRE = regexp.MustCompile(`^`+NORM+`$`)
+	lognormRE = regexp.MustCompile(`^`+LOGNORM+`$`)
+	triRE = regexp.MustCompile(`^`+TRI+`$`)
+	weibRE = regexp.MustCompile(`^`+WEIB+`$`)
+	gammaRE = regexp.MustCompile(`^`+GAMMA+`$`)
+	hyperRE = regexp.MustCompile(`^`+HYPER+`$`)
+	empirRE = regexp.MustCompile(`^`+EMPIR+`$`)
+	guardRE = regexp.MustCompile(`^`+GUARD+`$`)
 
 }
 
 
+// state of parsing shared by net and instances of modules
+type parsing struct {
+	net *Net
+	colourSets map[string]*ColourSet
+	atoms map[string]int // constants usable in expressions
+	modules map[string]*module
+	depth int // of nested instances
+	errInInstance bool // error is already marked with instance
+	dir string // of data files
+}
+
+// module is subnet defined once and instantiated many times
+type module struct {
+	ports []string // ids of places bound to outer places
+	lines []string
+	offset int // line number of first line of module body
+}
+
+// Parse parses net in penego notation,
+// relative paths of data files are resolved against current directory
 func Parse(input string) (net Net, err error) {
+	return ParseInDir(input, ".")
+}
+
+// ParseInDir is same as Parse,
+// but relative paths of data files are resolved against dir, eg. directory of .pn file
+func ParseInDir(input string, dir string) (net Net, err error) {
 
 	net.places = Places{}
 	net.transitions = Transitions{}
+	net.instances = []*Instance{}
 
 	lines := strings.Split(input, "\n")
 
-	namedPlaces := make(map[string]*Place)
+	ps := &parsing{
+		net: &net,
+		colourSets: map[string]*ColourSet{"int": IntColours},
+		atoms: make(map[string]int),
+		modules: make(map[string]*module),
+		dir: dir,
+	}
+
+
+	/* ----------- parse modules ----------- */
+
+	for i := 0; i < len(lines); i++ {
+		line := strings.TrimSpace(lines[i])
+		if isModuleHeader(line) {
+
+			name := getSubmatchString(moduleRE, line, "name")
+			if _, exists := ps.modules[name]; exists {
+				err = errors.New("module `"+name+"` is already defined")
+				return
+			}
+			mod := &module{
+				ports: splitIds(getSubmatchString(moduleRE, line, "ports")),
+				offset: i+1,
+			}
+			for j, port := range mod.ports {
+				for _, other := range mod.ports[:j] {
+					if port == other {
+						err = errors.New("port `"+port+"` used multiple times in module `"+name+"`")
+						return
+					}
+				}
+			}
+			lines[i] = ""
+			for i++; i < len(lines) && !isModuleEnd(strings.TrimSpace(lines[i])); i++ {
+				if isModuleHeader(strings.TrimSpace(lines[i])) {
+					err = errors.New("module can not be defined inside module at line " + strconv.Itoa(i))
+					return
+				}
+				mod.lines = append(mod.lines, lines[i])
+				lines[i] = ""
+			}
+			if i == len(lines) {
+				err = errors.New("module `"+name+"` is not closed by `}`")
+				return
+			}
+			lines[i] = ""
+			ps.modules[name] = mod
+
+		} else if isModuleEnd(line) {
+			err = errors.New("unexpected `}` at line " + strconv.Itoa(i))
+			return
+		}
+	}
+
 
+	/* ----------- parse colour sets ----------- */
+
+	for _, line := range lines {
+		line = strings.TrimSpace(line)
+		if isColourSetDefinition(line) {
+
+			name := getSubmatchString(colsetRE, line, "name")
+			if _, exists := ps.colourSets[name]; exists {
+				err = errors.New("colour set `"+name+"` is already defined")
+				return
+			}
+			colourSet := &ColourSet{Name: name, Atoms: []string{}}
+			for i, atom := range strings.Split(getSubmatchString(colsetRE, line, "atoms"), ",") {
+				atom = strings.TrimSpace(atom)
+				if _, exists := ps.atoms[atom]; exists {
+					err = errors.New("atom `"+atom+"` is already defined")
+					return
+				}
+				ps.atoms[atom] = i
+				colourSet.Atoms = append(colourSet.Atoms, atom)
+			}
+			ps.colourSets[name] = colourSet
+		}
+	}
+
+
+	err = ps.parseLines(lines, 0, "", make(map[string]*Place))
+
+	return net, err
+}
+
+// parseLines parses places, instances of modules and transitions
+// of net or of instance of module
+// ids of new places are prefixed by prefix, namedPlaces holds places visible in scope
+// offset is line number of first line
+func (ps *parsing) parseLines(lines []string, offset int, prefix string, namedPlaces map[string]*Place) (err error) {
 
 	/* ----------- parse places ----------- */
 
 	for i, line := range lines {
 		line = strings.TrimSpace(line)
+		if prefix != "" && isColourSetDefinition(line) {
+			err = errors.New("colour set can not be defined inside module at line " + strconv.Itoa(offset+i))
+			return
+		}
 		if isPlaceDefinition(line) {
 
 			id := getSubmatchString(placeRE, line, "id")
-			num, _ := strconv.Atoi(getSubmatchString(placeRE, line, "num"))
+			marking := getSubmatchString(placeRE, line, "num")
 			desc := getSubmatchString(placeRE, line, "desc")
+			capStr := getSubmatchString(placeRE, line, "cap")
+			capacity, _ := strconv.Atoi(capStr)
+			colsetName := getSubmatchString(placeRE, line, "colset")
 
 			if _, exists := namedPlaces[id]; exists {
 				err = errors.New("place with id `"+id+"` is already defined")
 				return
 			}
 			place := &Place{
-				Tokens: num,
+				Capacity: capacity,
 				Description: unPack(desc), // strip first and last char
-				id: id,
+				id: prefix + id,
+			}
+			if colsetName == "" {
+				if marking != "" {
+					num, convErr := strconv.Atoi(marking)
+					if convErr != nil {
+						err = errors.New("place `"+id+"` without colour set can not have coloured tokens")
+						return
+					}
+					place.Tokens = num
+				}
+			} else {
+				colourSet, exists := ps.colourSets[colsetName]
+				if !exists {
+					err = errors.New("undefined colour set `"+colsetName+"` used for place `"+id+"`")
+					return
+				}
+				place.Colours = colourSet
+				place.Values, err = parseMarking(marking, colourSet, ps.atoms)
+				if err != nil {
+					err = errors.New(err.Error()+" in place `"+id+"`")
+					return
+				}
+				for _, n := range place.Values {
+					place.Tokens += n
+				}
+			}
+			if capStr != "" && capacity == 0 {
+				err = errors.New("capacity of place `"+id+"` must be positive")
+				return
+			}
+			if capacity > 0 && place.Tokens > capacity {
+				err = errors.New("place `"+id+"` has more tokens than its capacity")
+				return
 			}
 			namedPlaces[id] = place
-			net.places.Push(place)
+			ps.net.places.Push(place)
 
 		} else {
-			if !isEmptyLine(line) && !isTransitionDefinition(line) {
-				err = errors.New("syntax error at line " + strconv.Itoa(i))
+			if !isEmptyLine(line) && !isDefinition(line) {
+				err = errors.New("syntax error at line " + strconv.Itoa(offset+i))
 				return
 			}
 		}
 	}
 
 
+	/* ----------- parse instances of modules ----------- */
+
+	instanceNames := map[string]bool{}
+	for i, line := range lines {
+		line = strings.TrimSpace(line)
+		if isInstanceDefinition(line) {
+
+			name := getSubmatchString(instanceRE, line, "name")
+			moduleName := getSubmatchString(instanceRE, line, "module")
+			args := splitIds(getSubmatchString(instanceRE, line, "args"))
+			desc := getSubmatchString(instanceRE, line, "desc")
+
+			mod, exists := ps.modules[moduleName]
+			if !exists {
+				err = errors.New("undefined module `"+moduleName+"` at line " + strconv.Itoa(offset+i))
+				return
+			}
+			if instanceNames[name] {
+				err = errors.New("instance `"+name+"` is already defined at line " + strconv.Itoa(offset+i))
+				return
+			}
+			instanceNames[name] = true
+			if len(args) != len(mod.ports) {
+				err = fmt.Errorf("module `%s` has %d ports, but %d places given at line %d", moduleName, len(mod.ports), len(args), offset+i)
+				return
+			}
+			if ps.depth >= maxModuleDepth {
+				err = errors.New("modules nested too deep, possible recursion at line " + strconv.Itoa(offset+i))
+				return
+			}
+
+			scope := make(map[string]*Place) // ports are bound to outer places
+			ports := Places{}
+			for j, arg := range args {
+				place, exists := namedPlaces[arg]
+				if !exists {
+					err = errors.New("undefined place id `"+arg+"` used in instance at line " + strconv.Itoa(offset+i))
+					return
+				}
+				scope[mod.ports[j]] = place
+				ports.Push(place)
+			}
+
+			firstPlace, firstTransition := len(ps.net.places), len(ps.net.transitions)
+			ps.depth++
+			err = ps.parseLines(mod.lines, mod.offset, prefix+name+".", scope)
+			ps.depth--
+			if err != nil {
+				if !ps.errInInstance { // innermost instance only
+					err = errors.New(err.Error() + " (in instance `"+prefix+name+"`)")
+					ps.errInInstance = true
+				}
+				return
+			}
+
+			if prefix == "" { // only top level instances, nested are part of them
+				ps.net.instances = append(ps.net.instances, &Instance{
+					Name: name,
+					Module: moduleName,
+					Description: unPack(desc),
+					Ports: ports,
+					Places: append(Places{}, ps.net.places[firstPlace:]...),
+					Transitions: append(Transitions{}, ps.net.transitions[firstTransition:]...),
+				})
+			}
+		}
+	}
+
+
 	/* ----------- parse transitions ----------- */
 
 	for i, line := range lines {
@@ -128,18 +473,26 @@ func Parse(input string) (net Net, err error) {
 			desc := getSubmatchString(transitionRE, line, "desc")
 
 
-			getArcsByList := func(list string) Arcs {
+			// returns arcs of given kind (prefix) only
+			getArcsByList := func(list string, kind string) Arcs {
 				arcs := Arcs{}
 				list = strings.TrimSpace(list)
 				if list == "" {
 					return arcs
 				}
-				for _, pair := range strings.Split(list, ",") {
-					pair := strings.Split(strings.TrimSpace(pair), "*")
-					id := strings.TrimSpace(pair[len(pair)-1])
+				for _, item := range strings.Split(list, ",") {
+					item = strings.TrimSpace(item)
+					itemKind := ""
+					if strings.ContainsAny(item[:1], arcKinds) {
+						itemKind, item = item[:1], strings.TrimSpace(item[1:])
+					}
+					if itemKind != kind {
+						continue
+					}
+					id := getSubmatchString(arcRE, item, "id")
 					w := 1
-					if len(pair) == 2 {
-						w, _ = strconv.Atoi(strings.TrimSpace(pair[0]))
+					if wStr := getSubmatchString(arcRE, item, "w"); wStr != "" {
+						w, _ = strconv.Atoi(wStr)
 					}
 					if place, exists := namedPlaces[id]; !exists {
 						err = errors.New("undefined place id `"+id+"` used in transition")
@@ -150,14 +503,29 @@ func Parse(input string) (net Net, err error) {
 								err = errors.New("place `"+place.id+"` used multiple times in one side of transition")
 							}
 						}
-						arcs.Push(w, place)
+						arc := Arc{Weight: w, Place: place}
+						if inscr := getSubmatchString(arcRE, item, "inscr"); inscr != "" {
+							var inscrErr error
+							arc.Inscription, inscrErr = ParseExpr(inscr, ps.atoms)
+							if inscrErr != nil {
+								err = inscrErr
+								return arcs
+							}
+						}
+						arcs = append(arcs, arc)
 					}
 				}
 				return arcs
 			}
 
-			origins := getArcsByList(listin)
-			targets := getArcsByList(listout)
+			origins := getArcsByList(listin, "")
+			reads := getArcsByList(listin, "?")
+			inhibitors := getArcsByList(listin, "!")
+			resets := getArcsByList(listin, "~")
+			targets := getArcsByList(listout, "")
+			if err != nil {
+				return
+			}
 
 			// changes `[] -> n` to `S -> [] -> n,S`
 			// where S is hidden place creating self loop
@@ -167,53 +535,287 @@ func Parse(input string) (net Net, err error) {
 				targets.Push(1, selfLoopPlace)
 			}
 
-			priority := 0
-			var timeFunc *TimeFunc
-
-			if attr != "" {
-				prio := getSubmatchString(transitionRE, line, "prio")
-				fix := getSubmatchString(transitionRE, line, "fix")
-				unif := getSubmatchString(transitionRE, line, "unif")
-				exp := getSubmatchString(transitionRE, line, "exp")
-				erl := getSubmatchString(transitionRE, line, "erl")
-				switch {
-					case prio != "":
-						priority, _ = strconv.Atoi(prio)
-					case fix != "":
-						timeFunc = GetConstantTimeFunc(parseTime(fix))
-					case unif != "":
-						from := getSubmatchString(transitionRE, line, "from")
-						to := getSubmatchString(transitionRE, line, "to")
-						timeFunc = GetUniformTimeFunc(parseTime(from), parseTime(to))
-					case exp != "":
-						mean := getSubmatchString(transitionRE, line, "mean")
-						timeFunc = GetExponentialTimeFunc(parseTime(mean))
-					case erl != "":
-						mean := getSubmatchString(transitionRE, line, "mean")
-						k, _ := strconv.Atoi(getSubmatchString(transitionRE, line, "k"))
-						timeFunc = GetErlangTimeFunc(parseTime(mean), uint(k))
-				}
-			}
-
-
-			net.transitions.Push(Transition{
+			transition := Transition{
 				Origins: origins,
 				Targets: targets,
-				Priority: priority,
-				TimeFunc: timeFunc,
+				Reads: reads,
+				Inhibitors: inhibitors,
+				Resets: resets,
 				Description: unPack(desc),
-			})
+			}
+
+			err = ps.parseAttributes(attr, &transition)
+			if err == nil {
+				err = bindGuardPlaces(&transition, namedPlaces)
+			}
+			if err == nil {
+				err = checkInscriptions(&transition)
+			}
+			if err != nil {
+				err = errors.New(err.Error() + " at line " + strconv.Itoa(offset+i))
+				return
+			}
+
+			ps.net.transitions.Push(transition)
 
 		} else {
-			if !isEmptyLine(line) && !isPlaceDefinition(line) {
-				err = errors.New("syntax error at line " + strconv.Itoa(i))
+			if !isEmptyLine(line) && !isDefinition(line) {
+				err = errors.New("syntax error at line " + strconv.Itoa(offset+i))
 				return
 			}
 		}
 
 	}
 
-	return net, err
+	return
+}
+
+// parses list of comma separated attributes within brackets of transition
+func (ps *parsing) parseAttributes(attrs string, transition *Transition) error {
+	timings := 0
+	timingOnly := false // attributes related to timing
+	for _, attr := range splitAttributes(attrs) {
+		switch {
+		case prioRE.MatchString(attr):
+			transition.Priority, _ = strconv.Atoi(getSubmatchString(prioRE, attr, "prio"))
+		case weightRE.MatchString(attr):
+			transition.Weight, _ = strconv.ParseFloat(getSubmatchString(weightRE, attr, "weight"), 64)
+			if transition.Weight <= 0 {
+				return errors.New("weight of transition must be positive")
+			}
+		case serversRE.MatchString(attr):
+			if servers := getSubmatchString(serversRE, attr, "servers"); servers != "inf" {
+				transition.Servers, _ = strconv.Atoi(servers)
+				if transition.Servers == 0 {
+					return errors.New("transition must have at least one server")
+				}
+			}
+			timingOnly = true
+		case memoryRE.MatchString(attr):
+			transition.Memory = map[string]Memory{
+				"enabling": EnablingMemory,
+				"age": AgeMemory,
+				"resampling": ResamplingMemory,
+			}[getSubmatchString(memoryRE, attr, "memory")]
+			timingOnly = true
+		case fixRE.MatchString(attr):
+			timings++
+			transition.TimeFunc = GetConstantTimeFunc(parseTime(attr))
+		case unifRE.MatchString(attr):
+			timings++
+			from := getSubmatchString(unifRE, attr, "from")
+			to := getSubmatchString(unifRE, attr, "to")
+			transition.TimeFunc = GetUniformTimeFunc(parseTime(from), parseTime(to))
+		case expRE.MatchString(attr):
+			timings++
+			mean := getSubmatchString(expRE, attr, "mean")
+			transition.TimeFunc = GetExponentialTimeFunc(parseTime(mean))
+		case erlRE.MatchString(attr):
+			timings++
+			mean := getSubmatchString(erlRE, attr, "mean")
+			k, _ := strconv.Atoi(getSubmatchString(erlRE, attr, "k"))
+			transition.TimeFunc = GetErlangTimeFunc(parseTime(mean), uint(k))
+		case normRE.MatchString(attr):
+			timings++
+			mean := getSubmatchString(normRE, attr, "mean")
+			sd := getSubmatchString(normRE, attr, "sd")
+			transition.TimeFunc = GetNormalTimeFunc(parseTime(mean), parseTime(sd))
+		case lognormRE.MatchString(attr):
+			timings++
+			mean := parseTime(getSubmatchString(lognormRE, attr, "mean"))
+			sd := parseTime(getSubmatchString(lognormRE, attr, "sd"))
+			if mean == 0 {
+				return errors.New("mean of lognormal distribution must be positive")
+			}
+			transition.TimeFunc = GetLognormalTimeFunc(mean, sd)
+		case triRE.MatchString(attr):
+			timings++
+			min := parseTime(getSubmatchString(triRE, attr, "min"))
+			mode := parseTime(getSubmatchString(triRE, attr, "mode"))
+			max := parseTime(getSubmatchString(triRE, attr, "max"))
+			if min > mode || mode > max {
+				return errors.New("triangular distribution requires min <= mode <= max")
+			}
+			transition.TimeFunc = GetTriangularTimeFunc(min, mode, max)
+		case weibRE.MatchString(attr):
+			timings++
+			scale := getSubmatchString(weibRE, attr, "scale")
+			k, _ := strconv.ParseFloat(getSubmatchString(weibRE, attr, "k"), 64)
+			if k <= 0 {
+				return errors.New("shape of weibull distribution must be positive")
+			}
+			transition.TimeFunc = GetWeibullTimeFunc(k, parseTime(scale))
+		case gammaRE.MatchString(attr):
+			timings++
+			scale := getSubmatchString(gammaRE, attr, "scale")
+			k, _ := strconv.ParseFloat(getSubmatchString(gammaRE, attr, "k"), 64)
+			if k <= 0 {
+				return errors.New("shape of gamma distribution must be positive")
+			}
+			transition.TimeFunc = GetGammaTimeFunc(k, parseTime(scale))
+		case hyperRE.MatchString(attr):
+			timings++
+			probs, means := []float64{}, []time.Duration{}
+			phases := strings.Split(getSubmatchString(hyperRE, attr, "phases"), ",")
+			for i := 0; i < len(phases); i += 2 {
+				p, _ := strconv.ParseFloat(phases[i], 64)
+				if p <= 0 {
+					return errors.New("probability of hyperexponential phase must be positive")
+				}
+				probs = append(probs, p)
+				means = append(means, parseTime(phases[i+1]))
+			}
+			transition.TimeFunc = GetHyperexponentialTimeFunc(probs, means)
+		case empirRE.MatchString(attr):
+			timings++
+			file := unPack(getSubmatchString(empirRE, attr, "file"))
+			interpolate := getSubmatchString(empirRE, attr, "mode") == "linear"
+			path := file
+			if !filepath.IsAbs(path) {
+				path = filepath.Join(ps.dir, path)
+			}
+			samples, err := readSamples(path)
+			if err != nil {
+				return err
+			}
+			transition.TimeFunc = GetEmpiricalTimeFunc(file, samples, interpolate)
+		case guardRE.MatchString(attr):
+			guard, err := ParseExpr(getSubmatchString(guardRE, attr, "expr"), ps.atoms)
+			if err != nil {
+				return err
+			}
+			transition.Guard = guard
+		default:
+			return errors.New("unknown attribute `" + attr + "`")
+		}
+	}
+	if timings > 1 {
+		return errors.New("transition can have only one timing")
+	}
+	if transition.TimeFunc != nil && transition.Weight != 0 {
+		return errors.New("weight can be used only for transition without timing")
+	}
+	if transition.TimeFunc == nil && timingOnly {
+		return errors.New("memory and servers can be used only for timed transition")
+	}
+	return nil
+}
+
+// splits attributes by commas, but not by those within parentheses
+func splitAttributes(attrs string) []string {
+	list := []string{}
+	depth, start := 0, 0
+	for i, r := range attrs + "," {
+		switch r {
+		case '(':
+			depth++
+		case ')':
+			depth--
+		case ',':
+			if depth == 0 {
+				if attr := strings.TrimSpace(attrs[start:i]); attr != "" {
+					list = append(list, attr)
+				}
+				start = i + 1
+			}
+		}
+	}
+	return list
+}
+
+// parses initial marking of coloured place, eg. `1, 2*3` or `2*student, teacher`
+func parseMarking(marking string, colourSet *ColourSet, atoms map[string]int) (Multiset, error) {
+	values := Multiset{}
+	if strings.TrimSpace(marking) == "" {
+		return values, nil
+	}
+	for _, token := range strings.Split(marking, ",") {
+		token = strings.TrimSpace(token)
+		n := 1
+		if nStr := getSubmatchString(tokenRE, token, "w"); nStr != "" {
+			n, _ = strconv.Atoi(nStr)
+		}
+		valueStr := getSubmatchString(tokenRE, token, "value")
+		value, err := strconv.Atoi(valueStr)
+		if err != nil { // atom
+			var exists bool
+			value, exists = atoms[valueStr]
+			if !exists || colourSet.Atoms == nil || !colourSet.Contains(value) || colourSet.Atoms[value] != valueStr {
+				return nil, errors.New("value `"+valueStr+"` is not in colour set `"+colourSet.Name+"`")
+			}
+		} else if !colourSet.Contains(value) || colourSet.Atoms != nil {
+			return nil, errors.New("value `"+valueStr+"` is not in colour set `"+colourSet.Name+"`")
+		}
+		values.Add(value, n)
+	}
+	return values, nil
+}
+
+// identifiers of guard which are not variables refer to number of tokens in place
+func bindGuardPlaces(transition *Transition, namedPlaces map[string]*Place) error {
+	if transition.Guard == nil {
+		return nil
+	}
+	variables := map[string]bool{}
+	for _, arc := range transition.Origins {
+		if name, ok := arc.Inscription.Ident(); ok {
+			variables[name] = true // variable hides place of the same name
+		}
+	}
+	transition.Guard.bindPlaces(func(name string) (*Place, bool) {
+		place, exists := namedPlaces[name]
+		return place, exists && !variables[name]
+	})
+	return nil
+}
+
+// checks that inscriptions are used only with coloured places
+// and that all variables are bound by inscriptions of origins
+func checkInscriptions(transition *Transition) error {
+	for _, arcs := range []Arcs{transition.Reads, transition.Inhibitors, transition.Resets} {
+		for _, arc := range arcs {
+			if arc.Inscription != nil {
+				return errors.New("only incomming and outcomming arcs can have inscription, not `"+arc.Place.id+"`")
+			}
+		}
+	}
+	bound := map[string]bool{}
+	for _, arcs := range []Arcs{transition.Origins, transition.Targets} {
+		for _, arc := range arcs {
+			if arc.Place.Colours == nil && arc.Inscription != nil {
+				return errors.New("place `"+arc.Place.id+"` without colour set can not have arc with inscription")
+			}
+			if arc.Place.Colours != nil && arc.Inscription == nil {
+				return errors.New("arc of coloured place `"+arc.Place.id+"` must have inscription")
+			}
+		}
+	}
+	for _, arc := range transition.Origins {
+		if name, ok := arc.Inscription.Ident(); ok {
+			bound[name] = true
+		}
+	}
+	exprs := []*Expr{transition.Guard}
+	for _, arcs := range []Arcs{transition.Origins, transition.Targets} {
+		for _, arc := range arcs {
+			exprs = append(exprs, arc.Inscription)
+		}
+	}
+	for _, expr := range exprs {
+		if expr == nil {
+			continue
+		}
+		for _, name := range expr.Idents() {
+			if !bound[name] {
+				return errors.New("variable `"+name+"` is not bound by any incomming arc nor is it place")
+			}
+		}
+	}
+	return nil
+}
+
+func isColourSetDefinition(line string) bool {
+	return colsetRE.MatchString(line)
 }
 
 func isPlaceDefinition(line string) bool {
@@ -224,6 +826,23 @@ func isTransitionDefinition(line string) bool {
 	return transitionRE.MatchString(line)
 }
 
+func isModuleHeader(line string) bool {
+	return moduleRE.MatchString(line)
+}
+
+func isModuleEnd(line string) bool {
+	return moduleEndRE.MatchString(line)
+}
+
+func isInstanceDefinition(line string) bool {
+	return instanceRE.MatchString(line)
+}
+
+func isDefinition(line string) bool {
+	return isColourSetDefinition(line) || isPlaceDefinition(line) ||
+		isTransitionDefinition(line) || isInstanceDefinition(line)
+}
+
 func isEmptyLine(line string) bool {
 	return emptyLineRE.MatchString(line)
 }
@@ -248,6 +867,17 @@ func parseTime(tstr string) time.Duration {
 	}
 }
 
+// splits comma separated list of ids
+func splitIds(list string) []string {
+	ids := []string{}
+	for _, id := range strings.Split(list, ",") {
+		if id = strings.TrimSpace(id); id != "" {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
 func unPack(str string) string {
 	if len(str) > 2 {
 		return string(str[1:len(str)-1])
@@ -0,0 +1,198 @@
+package net
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// default maximal number of states of reachability graph
+const DefaultStateLimit = 10000
+
+/******* types *******/
+
+/* ReachabilityGraph */
+
+// ReachabilityGraph of untimed net, nodes are reachable markings and edges are firings
+type ReachabilityGraph struct {
+	Places Places // marking of state has tokens in order of these places
+	States []State // first is initial
+	Edges []Edge
+	Truncated bool // limit of states was reached, so some states were not explored
+}
+
+type State struct {
+	Marking []int
+	Dead bool // no transition is enabled
+}
+
+type Edge struct {
+	From int // index of state
+	To int
+	Transition *Transition
+}
+
+// marking of state in penego notation, places without tokens are omitted
+func (graph ReachabilityGraph) markingString(state State) string {
+	parts := []string{}
+	for i, tokens := range state.Marking {
+		if tokens > 0 {
+			parts = append(parts, fmt.Sprintf("%s(%d)", placeName(graph.Places[i]), tokens))
+		}
+	}
+	if len(parts) == 0 {
+		return "empty"
+	}
+	return strings.Join(parts, ", ")
+}
+
+// WriteDOT writes graph in DOT language of Graphviz
+// initial state is drawn bold and dead states are double circled
+func (graph ReachabilityGraph) WriteDOT(w io.Writer) error {
+	buf := bufio.NewWriter(w)
+	fmt.Fprintln(buf, "digraph reachability {")
+	for i, state := range graph.States {
+		attrs := "label=" + strconv.Quote(graph.markingString(state))
+		if i == 0 {
+			attrs += ", style=bold"
+		}
+		if state.Dead {
+			attrs += ", shape=doublecircle"
+		}
+		fmt.Fprintf(buf, "\ts%d [%s];\n", i, attrs)
+	}
+	for _, edge := range graph.Edges {
+		fmt.Fprintf(buf, "\ts%d -> s%d [label=%s];\n", edge.From, edge.To, strconv.Quote(transitionName(edge.Transition)))
+	}
+	fmt.Fprintln(buf, "}")
+	return buf.Flush()
+}
+
+// WriteJSON writes graph as json object with places, states and edges
+func (graph ReachabilityGraph) WriteJSON(w io.Writer) error {
+	type jsonState struct {
+		Marking []int `json:"marking"`
+		Dead bool `json:"dead"`
+	}
+	type jsonEdge struct {
+		From int `json:"from"`
+		To int `json:"to"`
+		Transition string `json:"transition"`
+	}
+	out := struct {
+		Places []string `json:"places"`
+		States []jsonState `json:"states"`
+		Edges []jsonEdge `json:"edges"`
+		Truncated bool `json:"truncated"`
+	}{[]string{}, []jsonState{}, []jsonEdge{}, graph.Truncated}
+	for _, place := range graph.Places {
+		out.Places = append(out.Places, placeName(place))
+	}
+	for _, state := range graph.States {
+		out.States = append(out.States, jsonState{state.Marking, state.Dead})
+	}
+	for _, edge := range graph.Edges {
+		out.Edges = append(out.Edges, jsonEdge{edge.From, edge.To, transitionName(edge.Transition)})
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetEscapeHTML(false)
+	return encoder.Encode(out)
+}
+
+/******* net methods related to reachability *******/
+
+// Reachability builds reachability graph of net from its current marking, ignoring time
+// if immediate transitions are enabled, only those with the highest priority can fire,
+// otherwise any enabled timed transition can fire, as its time is random
+// at most limit states is explored, coloured nets are not supported
+func (net *Net) Reachability(limit int) (ReachabilityGraph, error) {
+	graph := ReachabilityGraph{Places: net.places}
+	for _, place := range net.places {
+		if place.Colours != nil {
+			return graph, errors.New("reachability graph of net with coloured place `" + place.id + "` is not supported")
+		}
+	}
+
+	initial := net.marking()
+	defer net.setMarking(initial)
+
+	index := map[string]int{} // states by marking
+	add := func(marking []int) int {
+		key := fmt.Sprint(marking)
+		if i, ok := index[key]; ok {
+			return i
+		}
+		index[key] = len(graph.States)
+		graph.States = append(graph.States, State{Marking: marking})
+		return len(graph.States) - 1
+	}
+	add(initial)
+
+	for from := 0; from < len(graph.States); from++ {
+		marking := graph.States[from].Marking
+		net.setMarking(marking)
+		fireable := net.fireable()
+		graph.States[from].Dead = len(fireable) == 0
+		for _, tran := range fireable {
+			net.setMarking(marking)
+			tran.doIn(nil)
+			tran.doOut()
+			next := net.marking()
+			if _, known := index[fmt.Sprint(next)]; !known && len(graph.States) >= limit {
+				graph.Truncated = true
+				continue
+			}
+			graph.Edges = append(graph.Edges, Edge{From: from, To: add(next), Transition: tran})
+		}
+	}
+	return graph, nil
+}
+
+// transitions which can fire in current marking when time is ignored
+func (net *Net) fireable() Transitions {
+	immediate, timed := Transitions{}, Transitions{}
+	for _, tran := range net.transitions {
+		if !tran.isEnabled() {
+			continue
+		}
+		if tran.TimeFunc == nil {
+			immediate = append(immediate, tran)
+		} else {
+			timed = append(timed, tran)
+		}
+	}
+	if len(immediate) == 0 {
+		return timed
+	}
+	priority := immediate[0].Priority
+	for _, tran := range immediate {
+		if tran.Priority > priority {
+			priority = tran.Priority
+		}
+	}
+	highest := Transitions{}
+	for _, tran := range immediate {
+		if tran.Priority == priority {
+			highest = append(highest, tran)
+		}
+	}
+	return highest
+}
+
+func (net *Net) marking() []int {
+	marking := make([]int, len(net.places))
+	for i, place := range net.places {
+		marking[i] = place.Tokens
+	}
+	return marking
+}
+
+func (net *Net) setMarking(marking []int) {
+	for i, place := range net.places {
+		place.Tokens = marking[i]
+	}
+}
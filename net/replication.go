@@ -0,0 +1,145 @@
+package net
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"runtime"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+/******* types *******/
+
+/* Summary */
+
+// Summary of statistics of independent replications or batches
+type Summary struct {
+	Runs int // count of replications or batches
+	Level float64 // confidence level of estimates
+	Places []PlaceSummary // in order of net
+	Transitions []TransitionSummary // in order of net
+}
+
+type PlaceSummary struct {
+	Place *Place
+	Mean Estimate
+	Variance Estimate
+	Min Estimate
+	Max Estimate
+	Resource bool
+	Utilization Estimate
+}
+
+type TransitionSummary struct {
+	Transition *Transition
+	Firings Estimate
+	Throughput Estimate
+}
+
+func (summary Summary) String() string {
+	buf := &bytes.Buffer{}
+	w := tabwriter.NewWriter(buf, 0, 8, 2, ' ', 0)
+	fmt.Fprintf(w, "runs\t%d\n", summary.Runs)
+	fmt.Fprintf(w, "place\tmean (%g%% conf.)\tmin\tmax\tutilization\n", summary.Level*100)
+	for _, ps := range summary.Places {
+		utilization := ""
+		if ps.Resource {
+			utilization = fmt.Sprintf("%.1f%% ± %.2g%%", ps.Utilization.Mean*100, ps.Utilization.HalfWidth*100)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%.4g\t%.4g\t%s\n", placeName(ps.Place), ps.Mean, ps.Min.Mean, ps.Max.Mean, utilization)
+	}
+	fmt.Fprintf(w, "transition\tfirings\tthroughput/s\n")
+	for _, ts := range summary.Transitions {
+		fmt.Fprintf(w, "%s\t%s\t%s\n", transitionName(ts.Transition), ts.Firings, ts.Throughput)
+	}
+	w.Flush()
+	return buf.String()
+}
+
+/******* exported functions *******/
+
+// Replicate runs count independent simulations in parallel, each on its own clone of net
+// replication i is seeded by i-th seed derived from given seed
+// setup, if not nil, is called with every simulation before it runs
+// returned statistics refer to places and transitions of given net
+// when ctx is canceled, no more replications are started and those running are ended,
+// statistics of started replications are returned together with error of ctx
+func Replicate(ctx context.Context, net Net, count int, startTime, endTime time.Duration, seed int64, setup func(*Simulation)) ([]Statistics, error) {
+	if count < 0 {
+		return nil, errors.New("count of replications can not be negative")
+	}
+	runs := make([]Statistics, count)
+	workers := make(chan struct{}, runtime.NumCPU()) // limits number of simultaneous runs
+	wg := sync.WaitGroup{}
+	started := 0
+	for ; started < count; started++ {
+		select {
+		case workers <- struct{}{}:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			break
+		}
+		wg.Add(1)
+		go func(i int) {
+			defer func() { <-workers; wg.Done() }()
+			clone := net.Clone()
+			sim := NewSimulation(startTime, endTime, clone)
+			sim.SetSeed(substreamSeed(seed, uint64(i)))
+			if setup != nil {
+				setup(&sim)
+			}
+			sim.Run(ctx)
+			runs[i] = sim.Statistics()
+			// refer to original net
+			for j := range runs[i].Places {
+				runs[i].Places[j].Place = net.places[j]
+			}
+			for j := range runs[i].Transitions {
+				runs[i].Transitions[j].Transition = net.transitions[j]
+			}
+		}(started)
+	}
+	wg.Wait()
+	return runs[:started], ctx.Err()
+}
+
+// Summarize computes estimates of statistics from independent runs at given confidence level, eg. 0.95
+// all runs have to be of the same net
+func Summarize(runs []Statistics, level float64) Summary {
+	summary := Summary{Runs: len(runs), Level: level}
+	if len(runs) == 0 {
+		return summary
+	}
+	estimate := func(value func(Statistics) float64) Estimate {
+		values := make([]float64, len(runs))
+		for i, run := range runs {
+			values[i] = value(run)
+		}
+		return NewEstimate(values, level)
+	}
+	for i, ps := range runs[0].Places {
+		i := i
+		summary.Places = append(summary.Places, PlaceSummary{
+			Place: ps.Place,
+			Mean: estimate(func(s Statistics) float64 { return s.Places[i].Mean }),
+			Variance: estimate(func(s Statistics) float64 { return s.Places[i].Variance }),
+			Min: estimate(func(s Statistics) float64 { return float64(s.Places[i].Min) }),
+			Max: estimate(func(s Statistics) float64 { return float64(s.Places[i].Max) }),
+			Resource: ps.Resource,
+			Utilization: estimate(func(s Statistics) float64 { return s.Places[i].Utilization }),
+		})
+	}
+	for i, ts := range runs[0].Transitions {
+		i := i
+		summary.Transitions = append(summary.Transitions, TransitionSummary{
+			Transition: ts.Transition,
+			Firings: estimate(func(s Statistics) float64 { return float64(s.Transitions[i].Firings) }),
+			Throughput: estimate(func(s Statistics) float64 { return s.Transitions[i].Throughput }),
+		})
+	}
+	return summary
+}
@@ -0,0 +1,30 @@
+package net
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+/******* tests *******/
+
+func TestReplicateInvalidCount(t *testing.T) {
+	net, _ := Parse("g (1)\n----\ng -> [exp(1s)] -> g")
+	if _, err := Replicate(context.Background(), net, -1, 0, time.Minute, 1, nil); err == nil {
+		t.Error("negative count of replications is accepted")
+	}
+}
+
+// no replication is started with canceled context
+func TestReplicateCanceled(t *testing.T) {
+	net, _ := Parse("g (1)\n----\ng -> [exp(1s)] -> g")
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	runs, err := Replicate(ctx, net, 100, 0, time.Hour, 1, nil)
+	if err != context.Canceled {
+		t.Errorf("error is %v, expected %v", err, context.Canceled)
+	}
+	if len(runs) != 0 {
+		t.Errorf("%d replications started after cancel", len(runs))
+	}
+}
@@ -0,0 +1,259 @@
+package net
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math"
+	"text/tabwriter"
+	"time"
+)
+
+/******* types *******/
+
+/* Statistics */
+
+// Statistics collected by simulation since its start (or end of warm-up)
+type Statistics struct {
+	Start time.Duration
+	End time.Duration
+	Places []PlaceStatistics // in order of net
+	Transitions []TransitionStatistics // in order of net
+}
+
+// time-weighted statistics of tokens in place
+type PlaceStatistics struct {
+	Place *Place
+	Mean float64
+	Variance float64
+	Min int
+	Max int
+	// resource place has capacity or is chosen by Simulation.SetResources
+	// its utilization is part of capacity which is occupied,
+	// for chosen place with initial tokens it is part of them which is missing (in use)
+	Resource bool
+	Utilization float64
+}
+
+type TransitionStatistics struct {
+	Transition *Transition
+	Firings int
+	Throughput float64 // firings per second
+}
+
+func (stats Statistics) String() string {
+	buf := &bytes.Buffer{}
+	w := tabwriter.NewWriter(buf, 0, 8, 2, ' ', 0)
+	fmt.Fprintf(w, "time\t%s..%s\n", stats.Start, stats.End)
+	fmt.Fprintf(w, "place\tmean\tsd\tmin\tmax\tutilization\n")
+	for _, ps := range stats.Places {
+		utilization := ""
+		if ps.Resource {
+			utilization = fmt.Sprintf("%.1f%%", ps.Utilization*100)
+		}
+		fmt.Fprintf(w, "%s\t%.4g\t%.4g\t%d\t%d\t%s\n",
+			placeName(ps.Place), ps.Mean, math.Sqrt(ps.Variance), ps.Min, ps.Max, utilization)
+	}
+	fmt.Fprintf(w, "transition\tfirings\tthroughput/s\n")
+	for _, ts := range stats.Transitions {
+		fmt.Fprintf(w, "%s\t%d\t%.4g\n", transitionName(ts.Transition), ts.Firings, ts.Throughput)
+	}
+	w.Flush()
+	return buf.String()
+}
+
+// name of place in statistics
+func placeName(place *Place) string {
+	if place.id == "" {
+		return place.Description
+	}
+	return place.id
+}
+
+// name of transition in statistics
+func transitionName(tran *Transition) string {
+	if tran.Description == "" {
+		return tran.String()
+	}
+	return tran.Description
+}
+
+/* collector */
+
+// collector accumulates statistics during simulation
+type collector struct {
+	net Net
+	resources map[*Place]bool // chosen resources, places with capacity are resources anyway
+	start time.Duration
+	places []placeCollector // in order of net
+	firings []int // in order of net
+	touched map[*Transition][]int // indexes of places which may be changed by transition
+}
+
+type placeCollector struct {
+	tokens int // since last change
+	since time.Duration
+	duration float64 // time with collected tokens, in seconds
+	mean float64 // time-weighted running mean of tokens
+	deviations float64 // time-weighted sum of squared deviations from mean
+	min int
+	max int
+}
+
+func newCollector(net Net, resources map[*Place]bool, now time.Duration) collector {
+	c := collector{
+		net: net,
+		resources: resources,
+		places: make([]placeCollector, len(net.places)),
+		firings: make([]int, len(net.transitions)),
+		touched: map[*Transition][]int{},
+	}
+	placeIndex := map[*Place]int{}
+	for i, place := range net.places {
+		placeIndex[place] = i
+	}
+	for _, tran := range net.transitions {
+		seen := map[int]bool{}
+		for _, arcs := range []Arcs{tran.Origins, tran.Resets, tran.Targets} {
+			for _, arc := range arcs {
+				i, ok := placeIndex[arc.Place]
+				if ok && !seen[i] { // hidden places are not in net
+					seen[i] = true
+					c.touched[tran] = append(c.touched[tran], i)
+				}
+			}
+		}
+	}
+	c.reset(now)
+	return c
+}
+
+// forgets everything collected so far, marking stays
+func (c *collector) reset(now time.Duration) {
+	c.start = now
+	for i, place := range c.net.places {
+		c.places[i] = placeCollector{
+			tokens: place.Tokens,
+			since: now,
+			min: place.Tokens,
+			max: place.Tokens,
+		}
+	}
+	for i := range c.firings {
+		c.firings[i] = 0
+	}
+}
+
+func (c collector) clone() collector {
+	clone := c
+	clone.places = append([]placeCollector{}, c.places...)
+	clone.firings = append([]int{}, c.firings...)
+	return clone
+}
+
+// records firing of transition which happened at time now
+func (c *collector) fired(tran *Transition, now time.Duration) {
+	c.firings[c.net.order[tran]]++
+	for _, i := range c.touched[tran] {
+		c.places[i].changed(c.net.places[i].Tokens, now)
+	}
+}
+
+func (pc *placeCollector) changed(tokens int, now time.Duration) {
+	pc.add(now)
+	pc.tokens = tokens
+	pc.since = now
+	if tokens < pc.min {
+		pc.min = tokens
+	}
+	if tokens > pc.max {
+		pc.max = tokens
+	}
+}
+
+// adds tokens held since last change until now to running mean and deviations
+// it is weighted variant of Welford's algorithm, which does not lose precision as sum of squares does
+func (pc *placeCollector) add(now time.Duration) {
+	dt := (now - pc.since).Seconds()
+	if dt <= 0 {
+		return
+	}
+	pc.duration += dt
+	delta := float64(pc.tokens) - pc.mean
+	pc.mean += delta * dt / pc.duration
+	pc.deviations += dt * delta * (float64(pc.tokens) - pc.mean)
+}
+
+func (c collector) statistics(now time.Duration) Statistics {
+	stats := Statistics{Start: c.start, End: now}
+	duration := (now - c.start).Seconds()
+	for i, place := range c.net.places {
+		pc := c.places[i]
+		pc.add(now) // pc is copy
+		ps := PlaceStatistics{Place: place, Min: pc.min, Max: pc.max}
+		if pc.duration > 0 {
+			ps.Mean = pc.mean
+			ps.Variance = pc.deviations / pc.duration
+		} else {
+			ps.Mean = float64(pc.tokens)
+		}
+		switch {
+		case c.resources[place] && place.initTokens > 0:
+			ps.Resource = true
+			ps.Utilization = math.Max(0, 1 - ps.Mean / float64(place.initTokens))
+		case place.Capacity > 0:
+			ps.Resource = true
+			ps.Utilization = ps.Mean / float64(place.Capacity)
+		}
+		stats.Places = append(stats.Places, ps)
+	}
+	for i, tran := range c.net.transitions {
+		ts := TransitionStatistics{Transition: tran, Firings: c.firings[i]}
+		if duration > 0 {
+			ts.Throughput = float64(ts.Firings) / duration
+		}
+		stats.Transitions = append(stats.Transitions, ts)
+	}
+	return stats
+}
+
+/******* simulation methods related to statistics *******/
+
+// Statistics returns statistics collected so far
+// it can be called from other goroutine while Run is running
+func (sim *Simulation) Statistics() Statistics {
+	c := sim.control
+	if c == nil {
+		return Statistics{}
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if !sim.started {
+		return newCollector(sim.net, sim.resources, sim.startTime).statistics(sim.startTime)
+	}
+	return sim.collector.statistics(sim.now)
+}
+
+// SetResources chooses places given by ids whose utilization is computed,
+// places with capacity are resources anyway
+// utilization of chosen place with initial tokens, eg. pool of servers, is part of them which is in use
+func (sim *Simulation) SetResources(ids ...string) error {
+	resources := map[*Place]bool{}
+	for _, id := range ids {
+		var found *Place
+		for _, place := range sim.net.places {
+			if place.id == id {
+				found = place
+			}
+		}
+		if found == nil {
+			return errors.New("unknown place `" + id + "` in resources")
+		}
+		if found.initTokens == 0 && found.Capacity == 0 {
+			return errors.New("resource `" + id + "` has neither initial tokens nor capacity")
+		}
+		resources[found] = true
+	}
+	sim.resources = resources
+	return nil
+}
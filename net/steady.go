@@ -0,0 +1,85 @@
+package net
+
+import (
+	"errors"
+	"time"
+)
+
+/******* simulation methods related to steady state estimation *******/
+
+// SetWarmUp sets duration from start after which collected statistics are forgotten,
+// so they are not biased by initial marking, marking itself is not touched
+// warm-up has to end before end of simulation
+func (sim *Simulation) SetWarmUp(warmUp time.Duration) error {
+	if warmUp < 0 || warmUp > 0 && warmUp >= sim.endTime - sim.startTime {
+		return errors.New("warm-up " + warmUp.String() + " does not end before end of simulation")
+	}
+	sim.warmUp = warmUp
+	return nil
+}
+
+// SetBatches splits time from end of warm-up until end of simulation into count batches of the same length,
+// statistics of every batch are collected separately, see BatchMeans
+func (sim *Simulation) SetBatches(count int) {
+	sim.batchCount = count
+}
+
+// Batches returns statistics of batches completed so far
+func (sim *Simulation) Batches() []Statistics {
+	c := sim.control
+	if c == nil {
+		return nil
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return append([]Statistics{}, sim.batches...)
+}
+
+// BatchMeans estimates steady state statistics from completed batches
+// with confidence intervals at given level, eg. 0.95
+func (sim *Simulation) BatchMeans(level float64) Summary {
+	return Summarize(sim.Batches(), level)
+}
+
+func (sim *Simulation) initBatches() {
+	sim.warmedUp = false
+	sim.batch = nil
+	sim.batches = nil
+	if sim.batchCount > 0 {
+		batch := newCollector(sim.net, sim.resources, sim.now)
+		sim.batch = &batch
+	}
+	sim.passBoundaries(sim.now)
+}
+
+// time when batch with index i ends
+func (sim *Simulation) batchEnd(i int) time.Duration {
+	if i + 1 == sim.batchCount {
+		return sim.endTime
+	}
+	start := sim.startTime + sim.warmUp
+	return start + (sim.endTime - start) / time.Duration(sim.batchCount) * time.Duration(i + 1) // divided first, not to overflow
+}
+
+// ends warm-up and batches which end until time t, marking is the same since last firing
+func (sim *Simulation) passBoundaries(t time.Duration) {
+	if !sim.warmedUp {
+		end := sim.startTime + sim.warmUp
+		if end > t {
+			return
+		}
+		sim.warmedUp = true
+		sim.collector.reset(end)
+		if sim.batch != nil {
+			sim.batch.reset(end)
+		}
+	}
+	for sim.batch != nil && len(sim.batches) < sim.batchCount {
+		end := sim.batchEnd(len(sim.batches))
+		if end > t {
+			break
+		}
+		sim.batches = append(sim.batches, sim.batch.statistics(end))
+		sim.batch.reset(end)
+	}
+}
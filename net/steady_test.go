@@ -0,0 +1,44 @@
+package net
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+/******* tests *******/
+
+// dead net keeps its marking until end, so warm-up and all batches end
+func TestWarmUpAndBatchesOfDeadNet(t *testing.T) {
+	net, err := Parse("g (3)\n----\ng -> [1s]")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sim := NewSimulation(0, 100*time.Second, net)
+	if err := sim.SetWarmUp(10 * time.Second); err != nil {
+		t.Fatal(err)
+	}
+	sim.SetBatches(5)
+	sim.Run(context.Background())
+	if sim.StopReason() != NoEvents {
+		t.Fatalf("simulation ended by %s, expected %s", sim.StopReason(), NoEvents)
+	}
+	stats := sim.Statistics()
+	if stats.Start != 10*time.Second || stats.End != 100*time.Second || stats.Places[0].Mean != 0 {
+		t.Errorf("statistics %s..%s with mean %g, expected 10s..1m40s with mean 0", stats.Start, stats.End, stats.Places[0].Mean)
+	}
+	if batches := len(sim.Batches()); batches != 5 {
+		t.Errorf("%d batches completed, expected 5", batches)
+	}
+}
+
+func TestWarmUpLongerThanSimulation(t *testing.T) {
+	net, _ := Parse("g (1)\n----\ng -> [1s] -> g")
+	sim := NewSimulation(0, time.Minute, net)
+	if err := sim.SetWarmUp(time.Minute); err == nil {
+		t.Error("warm-up as long as simulation is accepted")
+	}
+	if err := sim.SetWarmUp(-time.Second); err == nil {
+		t.Error("negative warm-up is accepted")
+	}
+}
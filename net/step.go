@@ -0,0 +1,234 @@
+package net
+
+import (
+	"time"
+)
+
+// count of steps which can be undone by default
+const DefaultHistoryLimit = 100
+
+/******* types *******/
+
+/* snapshot */
+
+// state of simulation before step
+// pseudo random generators are not part of it, so redone step may draw different times
+type snapshot struct {
+	now time.Duration
+	passes int
+	tokens []int
+	values []Multiset
+	calendar Calendar
+	dirty transitionSet
+	candidates transitionSet
+	remaining map[*Transition][]time.Duration
+	firings int
+	collector collector
+	warmedUp bool
+	batch *collector
+	batches int // count of completed batches
+	reason StopReason
+	met int
+}
+
+func (sim *Simulation) takeSnapshot() snapshot {
+	snap := snapshot{
+		now: sim.now,
+		passes: sim.passes,
+		firings: sim.firings,
+		tokens: make([]int, len(sim.net.places)),
+		values: make([]Multiset, len(sim.net.places)),
+		calendar: sim.calendar.clone(),
+		dirty: sim.dirty.clone(),
+		candidates: sim.candidates.clone(),
+		remaining: map[*Transition][]time.Duration{},
+		collector: sim.collector.clone(),
+		warmedUp: sim.warmedUp,
+		batches: len(sim.batches),
+		reason: sim.reason,
+		met: sim.met,
+	}
+	if sim.batch != nil {
+		batch := sim.batch.clone()
+		snap.batch = &batch
+	}
+	for i, place := range sim.net.places {
+		snap.tokens[i] = place.Tokens
+		if place.Colours != nil {
+			snap.values[i] = place.Values.copy()
+		}
+	}
+	for tran, remaining := range sim.remaining {
+		snap.remaining[tran] = append([]time.Duration{}, remaining...)
+	}
+	return snap
+}
+
+func (sim *Simulation) restoreSnapshot(snap snapshot) {
+	sim.now = snap.now
+	sim.passes = snap.passes
+	sim.firings = snap.firings
+	for i, place := range sim.net.places {
+		place.Tokens = snap.tokens[i]
+		if place.Colours != nil {
+			place.Values = snap.values[i]
+		}
+	}
+	sim.calendar = snap.calendar
+	sim.dirty = snap.dirty
+	sim.candidates = snap.candidates
+	sim.remaining = snap.remaining
+	sim.collector = snap.collector
+	sim.warmedUp = snap.warmedUp
+	sim.batch = snap.batch
+	sim.batches = sim.batches[:snap.batches]
+	sim.reason = snap.reason
+	sim.met = snap.met
+}
+
+func (c Calendar) clone() Calendar {
+	clone := Calendar{
+		events: make(eventHeap, len(c.events)),
+		byTransition: map[*Transition][]*Event{},
+		seq: c.seq,
+	}
+	for i, event := range c.events {
+		copied := *event
+		clone.events[i] = &copied
+		clone.byTransition[event.transition] = append(clone.byTransition[event.transition], &copied)
+	}
+	return clone
+}
+
+func (set transitionSet) clone() transitionSet {
+	clone := newTransitionSet(set.order)
+	clone.list = append(clone.list, set.list...)
+	for _, tran := range set.list {
+		clone.has[tran] = true
+	}
+	return clone
+}
+
+/******* simulation methods related to stepping *******/
+
+// prepares simulation to its start
+func (sim *Simulation) init() {
+	sim.restartRand()
+	sim.now = sim.startTime
+	sim.passes = 0
+	sim.calendar = newCalendar()
+	sim.updateAll()
+	sim.collector = newCollector(sim.net, sim.resources, sim.now)
+	sim.initBatches()
+	sim.history = sim.history[:0]
+	sim.reason = NotEnded
+	sim.firings = 0
+	sim.started = true
+	sim.checkConditions(nil) // initial marking may already satisfy condition
+}
+
+// brings net to its initial marking, next Run or Step starts from beginning
+func (sim *Simulation) reset() {
+	sim.net.restoreState()
+	sim.history = sim.history[:0]
+	sim.started = false
+}
+
+// step fires enabled immediate transition with the highest priority,
+// if there is none, it fires first scheduled event
+// returns fired transition and time advance, or nil if there is nothing to fire before end time
+// or stop condition has been met
+func (sim *Simulation) step() (*Transition, time.Duration) {
+	if sim.reason == ConditionMet {
+		return nil, 0
+	}
+	sim.reason = NotEnded
+	if tran := sim.nextImmediate(); tran != nil {
+		sim.passes++
+		if sim.passes > 1E3 {
+			panic("too many transitions done in same time, possible loop")
+		}
+		sim.fire(tran)
+		sim.checkConditions(tran)
+		return tran, 0
+	}
+	sim.scheduleEnabledTimed() // might create new event in current time
+	if sim.calendar.isEmpty() {
+		sim.reason = NoEvents
+		sim.passBoundaries(sim.endTime) // marking does not change any more
+		sim.now = sim.endTime
+		return nil, 0
+	}
+	if sim.calendar.peek() > sim.endTime {
+		sim.reason = EndReached
+		sim.passBoundaries(sim.endTime)
+		sim.now = sim.endTime // nothing happens until end
+		return nil, 0
+	}
+	sim.passBoundaries(sim.calendar.peek())
+	eventTime, tran := sim.calendar.shift()
+	advance := eventTime - sim.now
+	sim.now = eventTime
+	sim.passes = 0
+	sim.fire(tran)
+	sim.checkConditions(tran)
+	return tran, advance
+}
+
+// Step fires exactly one transition, see Run for which one goes first
+// returns fired transition and how much time advanced,
+// or nil if there is nothing more to fire or simulation is running
+func (sim *Simulation) Step() (*Transition, time.Duration) {
+	c := sim.control
+	if c == nil {
+		return nil, 0
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.running && !c.paused {
+		return nil, 0
+	}
+	if !sim.started {
+		sim.init()
+	}
+	snap := sim.takeSnapshot()
+	tran, advance := sim.step()
+	sim.publish()
+	if tran == nil {
+		return nil, 0
+	}
+	if sim.historyLimit > 0 {
+		if len(sim.history) == sim.historyLimit {
+			sim.history = append(sim.history[:0], sim.history[1:]...) // forget the oldest
+		}
+		sim.history = append(sim.history, snap)
+	}
+	return tran, advance
+}
+
+// StepBack restores marking and calendar as they were before last Step
+// returns false if there is no step to undo
+func (sim *Simulation) StepBack() bool {
+	c := sim.control
+	if c == nil {
+		return false
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.running && !c.paused || len(sim.history) == 0 {
+		return false
+	}
+	last := len(sim.history) - 1
+	sim.restoreSnapshot(sim.history[last])
+	sim.history = sim.history[:last]
+	sim.publish()
+	return true
+}
+
+// SetHistoryLimit sets how many steps can be undone by StepBack, 0 disables history
+func (sim *Simulation) SetHistoryLimit(limit int) {
+	sim.historyLimit = limit
+	if len(sim.history) > limit {
+		sim.history = append(sim.history[:0], sim.history[len(sim.history)-limit:]...)
+	}
+}
@@ -0,0 +1,32 @@
+package net
+
+import (
+	"testing"
+	"time"
+)
+
+/******* tests *******/
+
+// StepBack restores time and stop reason of simulation too
+func TestStepBackRestoresReason(t *testing.T) {
+	net, err := Parse("g (1)\no ()\n----\ng -> [1s] -> g, o")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sim := NewSimulation(0, time.Minute, net)
+	cond, _ := MarkingCondition("o >= 2")
+	if err := sim.StopWhen(cond); err != nil {
+		t.Fatal(err)
+	}
+	sim.Step()
+	sim.Step()
+	if _, ok := sim.MetCondition(); !ok || sim.StopReason() != ConditionMet || sim.GetNow() != 2*time.Second {
+		t.Fatalf("after two steps: %s at %s, expected %s at 2s", sim.StopReason(), sim.GetNow(), ConditionMet)
+	}
+	if !sim.StepBack() {
+		t.Fatal("step can not be undone")
+	}
+	if _, ok := sim.MetCondition(); ok || sim.StopReason() != NotEnded || sim.GetNow() != time.Second {
+		t.Errorf("after step back: %s at %s, expected %s at 1s", sim.StopReason(), sim.GetNow(), NotEnded)
+	}
+}
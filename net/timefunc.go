@@ -1,12 +1,17 @@
 package net
 
 import(
+	"encoding/csv"
+	"errors"
 	"fmt"
+	"os"
+	"sort"
 	"time"
 	"math"
 	"math/big"
 	"math/rand"
 	truerand "crypto/rand"
+	"strconv"
 	"strings"
 )
 
@@ -15,7 +20,8 @@ import(
 
 /* TimeFunc */
 
-type TimeFunc func() time.Duration
+// TimeFunc returns random time using given generator
+type TimeFunc func(rnd *rand.Rand) time.Duration
 
 func (fn *TimeFunc) String() string {
 	if repr, ok := timeFuncTextReprs[fn]; ok {
@@ -25,12 +31,21 @@ func (fn *TimeFunc) String() string {
 	}
 }
 
-func (fn *TimeFunc) SetTextRepr(name string, args... time.Duration) {
+// SetTextRepr sets text representation of time func in penego notation,
+// args are durations, shapes (float64) or counts (uint)
+func (fn *TimeFunc) SetTextRepr(name string, args... interface{}) {
 
 	arguments := make([]string,0)
 
 	for _, arg := range args {
-		arguments = append(arguments, trimZeroUnits(arg.String()))
+		switch arg := arg.(type) {
+		case time.Duration:
+			arguments = append(arguments, formatTime(arg))
+		case float64:
+			arguments = append(arguments, strconv.FormatFloat(arg, 'f', -1, 64))
+		default:
+			arguments = append(arguments, fmt.Sprint(arg))
+		}
 	}
 
 	timeFuncTextReprs[fn] = func() string {
@@ -39,10 +54,6 @@ func (fn *TimeFunc) SetTextRepr(name string, args... time.Duration) {
 			return arguments[0]
 		case "unif":
 			return arguments[0] + ".." + arguments[1]
-		case "exp":
-			return fmt.Sprintf("exp(%s)", arguments[0])
-		case "erlang":
-			return fmt.Sprintf("erlang(%d,%s)", uint(args[0]), arguments[1])
 		default:
 			return name + "(" + strings.Join(arguments, ",") + ")"
 		}
@@ -52,7 +63,9 @@ func (fn *TimeFunc) SetTextRepr(name string, args... time.Duration) {
 /******* global vars *******/
 
 var timeFuncTextReprs map[*TimeFunc] string
-var startSeed int64 = 1
+
+// seed used by simulation unless other is set
+const DefaultSeed int64 = 1
 
 
 /******* exported functions *******/
@@ -60,7 +73,7 @@ var startSeed int64 = 1
 /* timeFunc factories */
 
 func GetConstantTimeFunc(duration time.Duration) *TimeFunc {
-	fn := TimeFunc(func() time.Duration {
+	fn := TimeFunc(func(*rand.Rand) time.Duration {
 		return duration
 	})
 	fn.SetTextRepr("const", duration)
@@ -71,38 +84,113 @@ func GetUniformTimeFunc(from, to time.Duration) *TimeFunc {
 	if from > to {
 		from, to = to, from
 	}
-	fn := TimeFunc(func() time.Duration {
-		return uniformTime(from, to)
+	fn := TimeFunc(func(rnd *rand.Rand) time.Duration {
+		return uniformTime(rnd, from, to)
 	})
 	fn.SetTextRepr("unif", from, to)
 	return &fn
 }
 
 func GetExponentialTimeFunc(mean time.Duration) *TimeFunc {
-	fn := TimeFunc(func() time.Duration {
-		return exponentialTime(mean)
+	fn := TimeFunc(func(rnd *rand.Rand) time.Duration {
+		return exponentialTime(rnd, mean)
 	})
 	fn.SetTextRepr("exp", mean)
 	return &fn
 }
 
 func GetErlangTimeFunc(mean time.Duration, k uint) *TimeFunc {
-	fn := TimeFunc(func () time.Duration {
-		return erlangTime(mean, k)
+	fn := TimeFunc(func(rnd *rand.Rand) time.Duration {
+		return erlangTime(rnd, mean, k)
+	})
+	fn.SetTextRepr("erlang", k, mean)
+	return &fn
+}
+
+// normal distribution truncated to non-negative times
+func GetNormalTimeFunc(mean, sd time.Duration) *TimeFunc {
+	fn := TimeFunc(func(rnd *rand.Rand) time.Duration {
+		return normalTime(rnd, mean, sd)
+	})
+	fn.SetTextRepr("normal", mean, sd)
+	return &fn
+}
+
+// lognormal distribution given by mean and standard deviation of resulting time
+func GetLognormalTimeFunc(mean, sd time.Duration) *TimeFunc {
+	fn := TimeFunc(func(rnd *rand.Rand) time.Duration {
+		return lognormalTime(rnd, mean, sd)
+	})
+	fn.SetTextRepr("lognormal", mean, sd)
+	return &fn
+}
+
+func GetTriangularTimeFunc(min, mode, max time.Duration) *TimeFunc {
+	fn := TimeFunc(func(rnd *rand.Rand) time.Duration {
+		return triangularTime(rnd, min, mode, max)
+	})
+	fn.SetTextRepr("triangular", min, mode, max)
+	return &fn
+}
+
+func GetWeibullTimeFunc(shape float64, scale time.Duration) *TimeFunc {
+	fn := TimeFunc(func(rnd *rand.Rand) time.Duration {
+		return weibullTime(rnd, shape, scale)
+	})
+	fn.SetTextRepr("weibull", shape, scale)
+	return &fn
+}
+
+// gamma distribution with mean shape*scale, generalization of erlang for non-integer shapes
+func GetGammaTimeFunc(shape float64, scale time.Duration) *TimeFunc {
+	fn := TimeFunc(func(rnd *rand.Rand) time.Duration {
+		return gammaTime(rnd, shape, scale)
+	})
+	fn.SetTextRepr("gamma", shape, scale)
+	return &fn
+}
+
+// hyperexponential distribution, exponential with means[i] is chosen with probability probs[i]
+// probabilities are normalized, so they do not have to sum to 1
+func GetHyperexponentialTimeFunc(probs []float64, means []time.Duration) *TimeFunc {
+	sum := 0.0
+	args := []interface{}{}
+	for i, p := range probs {
+		sum += p
+		args = append(args, p, means[i])
+	}
+	fn := TimeFunc(func(rnd *rand.Rand) time.Duration {
+		return hyperexponentialTime(rnd, probs, means, sum)
 	})
-	fn.SetTextRepr("erlang", time.Duration(k), mean)
+	fn.SetTextRepr("hyperexp", args...)
 	return &fn
 }
 
 
+// empirical distribution given by samples loaded from file
+// with interpolate, times between samples are drawn from linearly interpolated CDF,
+// otherwise only values of samples are drawn
+// file is used only in text representation
+func GetEmpiricalTimeFunc(file string, samples []time.Duration, interpolate bool) *TimeFunc {
+	sorted := append([]time.Duration{}, samples...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	fn := TimeFunc(func(rnd *rand.Rand) time.Duration {
+		return empiricalTime(rnd, sorted, interpolate)
+	})
+	if interpolate {
+		fn.SetTextRepr("empirical", strconv.Quote(file), "linear")
+	} else {
+		fn.SetTextRepr("empirical", strconv.Quote(file))
+	}
+	return &fn
+}
+
 
-// Seed pseudo random generator with true random number.
-// This same seed is used at beginning of every simulation.Run()
-func TrueRandomSeed() {
+// TrueRandomSeed returns true random number usable as seed of simulation
+func TrueRandomSeed() int64 {
 	max := big.NewInt(math.MaxInt32)
 	seed, _ := truerand.Int(truerand.Reader, max)
-	startSeed = seed.Int64()
-	rand.Seed(startSeed)
+	return seed.Int64()
 }
 
 
@@ -112,28 +200,169 @@ func init () {
 	timeFuncTextReprs = make(map[*TimeFunc]string)
 }
 
-func restartSeed() {
-	rand.Seed(startSeed)
+// seed of independent substream given by key derived from seed of simulation (splitmix64)
+func substreamSeed(seed int64, key uint64) int64 {
+	z := uint64(seed) + (key+1)*0x9e3779b97f4a7c15
+	z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+	z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+	return int64(z ^ (z >> 31))
+}
+
+// formats time using single biggest unit which keeps it integer, so it can be parsed again
+func formatTime(t time.Duration) string {
+	units := []struct {
+		name string
+		size time.Duration
+	}{
+		{"d", 24 * time.Hour},
+		{"h", time.Hour},
+		{"m", time.Minute},
+		{"s", time.Second},
+		{"ms", time.Millisecond},
+		{"us", time.Microsecond},
+	}
+	for _, unit := range units {
+		if t != 0 && t%unit.size == 0 {
+			return strconv.FormatInt(int64(t/unit.size), 10) + unit.name
+		}
+	}
+	return strconv.FormatInt(int64(t), 10) // nanoseconds
 }
 
-func trimZeroUnits(input string) string {
-	return strings.Replace(strings.Replace(input, "m0s", "m", 1), "h0m", "h", 1)
+// reads samples of time from first column of csv file,
+// sample is either duration with unit, eg. `1m30s`, `2.5m` or number of seconds
+// first line may be header
+func readSamples(filename string) ([]time.Duration, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, errors.New("can not read samples: " + err.Error())
+	}
+	defer file.Close()
+
+	reader := csv.NewReader(file)
+	reader.FieldsPerRecord = -1
+	reader.Comment = '#'
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, errors.New("malformed samples file: " + err.Error())
+	}
+
+	samples := []time.Duration{}
+	for i, record := range records {
+		field := strings.TrimSpace(record[0])
+		sample, err := time.ParseDuration(field)
+		if err != nil {
+			seconds, convErr := strconv.ParseFloat(field, 64)
+			if convErr != nil {
+				if i == 0 {
+					continue // header
+				}
+				return nil, fmt.Errorf("invalid sample `%s` on line %d of %s", field, i+1, filename)
+			}
+			sample = time.Duration(seconds * float64(time.Second))
+		}
+		if sample < 0 {
+			return nil, fmt.Errorf("negative sample `%s` on line %d of %s", field, i+1, filename)
+		}
+		samples = append(samples, sample)
+	}
+	if len(samples) == 0 {
+		return nil, errors.New("no samples in " + filename)
+	}
+	return samples, nil
 }
 
 /* random functions*/
 
-func uniformTime(from, to time.Duration) time.Duration {
-	return from + time.Duration(rand.Int63n(int64(to-from)))
+func uniformTime(rnd *rand.Rand, from, to time.Duration) time.Duration {
+	return from + time.Duration(rnd.Int63n(int64(to-from)))
 }
 
-func exponentialTime(mean time.Duration) time.Duration {
-	return time.Duration(rand.ExpFloat64() * float64(mean))
+func exponentialTime(rnd *rand.Rand, mean time.Duration) time.Duration {
+	return time.Duration(rnd.ExpFloat64() * float64(mean))
 }
 
-func erlangTime(mean time.Duration, k uint) time.Duration {
+func erlangTime(rnd *rand.Rand, mean time.Duration, k uint) time.Duration {
 	t := time.Duration(0)
 	for ; k > 0; k-- {
-		t += exponentialTime(mean)
+		t += exponentialTime(rnd, mean)
 	}
 	return t
+}
+
+func normalTime(rnd *rand.Rand, mean, sd time.Duration) time.Duration {
+	for {
+		t := rnd.NormFloat64()*float64(sd) + float64(mean)
+		if t >= 0 { // truncated by rejection
+			return time.Duration(t)
+		}
+	}
+}
+
+func lognormalTime(rnd *rand.Rand, mean, sd time.Duration) time.Duration {
+	m, s := float64(mean), float64(sd)
+	sigma2 := math.Log(1 + s*s/(m*m))
+	mu := math.Log(m) - sigma2/2
+	return time.Duration(math.Exp(mu + math.Sqrt(sigma2)*rnd.NormFloat64()))
+}
+
+func triangularTime(rnd *rand.Rand, min, mode, max time.Duration) time.Duration {
+	a, c, b := float64(min), float64(mode), float64(max)
+	if a == b {
+		return min
+	}
+	u := rnd.Float64()
+	if u < (c-a)/(b-a) {
+		return time.Duration(a + math.Sqrt(u*(b-a)*(c-a)))
+	}
+	return time.Duration(b - math.Sqrt((1-u)*(b-a)*(b-c)))
+}
+
+func weibullTime(rnd *rand.Rand, shape float64, scale time.Duration) time.Duration {
+	return time.Duration(float64(scale) * math.Pow(rnd.ExpFloat64(), 1/shape))
+}
+
+// Marsaglia and Tsang method
+func gammaTime(rnd *rand.Rand, shape float64, scale time.Duration) time.Duration {
+	boost := 1.0
+	if shape < 1 { // gamma(k) = gamma(k+1) * U^(1/k)
+		boost = math.Pow(rnd.Float64(), 1/shape)
+		shape++
+	}
+	d := shape - 1.0/3
+	c := 1 / math.Sqrt(9*d)
+	for {
+		x := rnd.NormFloat64()
+		v := 1 + c*x
+		if v <= 0 {
+			continue
+		}
+		v = v * v * v
+		u := rnd.Float64()
+		if math.Log(u) < x*x/2+d-d*v+d*math.Log(v) {
+			return time.Duration(d * v * boost * float64(scale))
+		}
+	}
+}
+
+// samples must be sorted
+func empiricalTime(rnd *rand.Rand, samples []time.Duration, interpolate bool) time.Duration {
+	if !interpolate || len(samples) == 1 {
+		return samples[rnd.Intn(len(samples))]
+	}
+	pos := rnd.Float64() * float64(len(samples)-1)
+	i := int(pos)
+	frac := pos - float64(i)
+	return samples[i] + time.Duration(frac*float64(samples[i+1]-samples[i]))
+}
+
+func hyperexponentialTime(rnd *rand.Rand, probs []float64, means []time.Duration, sum float64) time.Duration {
+	r := rnd.Float64() * sum
+	for i, p := range probs {
+		r -= p
+		if r < 0 {
+			return exponentialTime(rnd, means[i])
+		}
+	}
+	return exponentialTime(rnd, means[len(means)-1])
 }
\ No newline at end of file
@@ -1,17 +1,21 @@
 package main // import "git.yo2.cz/drahoslav/penego"
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"git.yo2.cz/drahoslav/penego/compose"
 	"git.yo2.cz/drahoslav/penego/export"
 	"git.yo2.cz/drahoslav/penego/gui"
 	"git.yo2.cz/drahoslav/penego/net"
+	"git.yo2.cz/drahoslav/penego/trace"
 	"github.com/pkg/profile"
 	"github.com/sqweek/dialog"
 	"io/ioutil"
 	"log"
 	"os"
+	"path/filepath"
+	"strings"
 	"time"
 )
 
@@ -76,14 +80,28 @@ func main() {
 	// flags
 
 	var (
-		startTime  = time.Duration(0)
-		endTime    = time.Hour * 24 * 1e5
-		timeFlow   = ContinuousFlow
-		timeSpeed  = uint(10)
-		trueRandom = false
-		noClose    = true
-		verbose    = false
-		autoStart  = false
+		startTime   = time.Duration(0)
+		endTime     = time.Hour * 24 * 1e5
+		timeFlow    = ContinuousFlow
+		timeSpeed   = uint(10)
+		trueRandom  = false
+		seed        = net.DefaultSeed
+		noClose     = true
+		verbose     = false
+		autoStart   = false
+		traceFile   = ""
+		traceFormat = "csv"
+		printStats  = false
+		warmUp      = time.Duration(0)
+		batches     = 0
+		confidence  = 0.95
+		resources   = ""
+		headless    = false
+		stopWhen    = ""
+		maxFirings  = -1 // no limit
+		stopFiring  = ""
+		reachFile   = ""
+		stateLimit  = net.DefaultStateLimit
 	)
 
 	flag.DurationVar(&startTime, "start", startTime, "start `time` of simulation")
@@ -91,10 +109,31 @@ func main() {
 	flag.Var(&timeFlow, "flow", "type of time flow\n\tno, continuous, or natural")
 	flag.UintVar(&timeSpeed, "speed", timeSpeed, "time flow acceleration\n\tdifferent meaning for different -flow\n\t")
 	flag.BoolVar(&trueRandom, "truerandom", trueRandom, "seed pseudo random generator with true random seed on start")
+	flag.Int64Var(&seed, "seed", seed, "`seed` of pseudo random generator\n\tsame seed gives same simulation")
 	flag.BoolVar(&noClose, "noclose", noClose, "preserve window after simulation ends")
 	flag.BoolVar(&verbose, "v", verbose, "be more verbose")
 	flag.BoolVar(&autoStart, "autostart", autoStart, "automatic start")
+	flag.StringVar(&traceFile, "trace", traceFile, "write record of every firing to `file`")
+	flag.StringVar(&traceFormat, "traceformat", traceFormat, "format of trace\n\tcsv or jsonl")
+	flag.BoolVar(&printStats, "stats", printStats, "print statistics of places and transitions when simulation ends")
+	flag.DurationVar(&warmUp, "warmup", warmUp, "statistics are collected after warm-up `time`")
+	flag.IntVar(&batches, "batches", batches, "estimate steady state by batch means of `count` batches")
+	flag.Float64Var(&confidence, "confidence", confidence, "confidence `level` of estimates")
+	flag.StringVar(&resources, "resources", resources, "comma-separated `ids` of places whose utilization is printed with statistics\n\tplaces with capacity are resources anyway")
+	flag.StringVar(&stopWhen, "stopwhen", stopWhen, "stop simulation when marking `predicate` holds, eg. \"o >= 1000\"")
+	flag.IntVar(&maxFirings, "maxfirings", maxFirings, "stop simulation after `count` firings")
+	flag.StringVar(&stopFiring, "stopfiring", stopFiring, "stop simulation when `transition` given by its description fires first time")
+	flag.StringVar(&reachFile, "reachability", reachFile, "write reachability graph of untimed net to `file` and exit\n\tformat is given by extension: .dot or .json")
+	flag.IntVar(&stateLimit, "states", stateLimit, "maximal `count` of states of reachability graph")
+	flag.BoolVar(&headless, "headless", headless, "run without window as fast as possible\n\tand print final marking, statistics and why simulation ended")
 	flag.Parse()
+	if flag.Arg(0) == "run" { // `penego run file.pn` is the same as `penego -headless file.pn`
+		headless = true
+		flag.CommandLine.Parse(flag.Args()[1:])
+	}
+	if confidence <= 0 || confidence >= 1 {
+		log.Fatal("confidence level has to be between 0 and 1")
+	}
 
 	////////////////////////////////
 
@@ -110,10 +149,10 @@ func main() {
 		}
 		return string(fileContent)
 	}
-	parse := func(pnString string) (network net.Net) {
-		network, err = net.Parse(pnString)
+	parse := func(pnString string, filename string) (network net.Net) {
+		network, err = net.ParseInDir(pnString, filepath.Dir(filename)) // data files are relative to pn file
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "%s", err)
+			fmt.Fprintln(os.Stderr, err)
 			return
 		}
 		if verbose {
@@ -129,7 +168,96 @@ func main() {
 	} else {
 		fmt.Println("No pn file specified, using example")
 	}
-	network = parse(pnString)
+	network = parse(pnString, filename)
+
+	if reachFile != "" {
+		if err != nil {
+			os.Exit(1)
+		}
+		if err := writeReachability(network, reachFile, stateLimit); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	// stop conditions given by flags
+	conditions := []net.StopCondition{}
+	if stopWhen != "" {
+		cond, err := net.MarkingCondition(stopWhen)
+		if err != nil {
+			log.Fatal(err)
+		}
+		conditions = append(conditions, cond)
+	}
+	if maxFirings >= 0 {
+		conditions = append(conditions, net.MaxFiringsCondition(maxFirings))
+	}
+	if stopFiring != "" {
+		conditions = append(conditions, net.FirstFiringCondition(stopFiring))
+	}
+	stopWhenConditions := func(sim *net.Simulation) error {
+		for _, cond := range conditions {
+			if err := sim.StopWhen(cond); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	// resources given by flag
+	resourceIds := []string{}
+	for _, id := range strings.Split(resources, ",") {
+		if id = strings.TrimSpace(id); id != "" {
+			resourceIds = append(resourceIds, id)
+		}
+	}
+
+	////////////////////////////////
+
+	if headless {
+		if err != nil {
+			os.Exit(1)
+		}
+		sim := net.NewSimulation(startTime, endTime, network)
+		if trueRandom {
+			seed = net.TrueRandomSeed()
+		}
+		sim.SetSeed(seed)
+		if err := sim.SetWarmUp(warmUp); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		sim.SetBatches(batches)
+		if err := stopWhenConditions(&sim); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		if err := sim.SetResources(resourceIds...); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		if verbose {
+			sim.DoEveryStateChange(func(before, now time.Duration) {
+				fmt.Println(now, network.Places())
+			})
+		}
+		if traceFile != "" {
+			tracer, closeTrace, err := createTrace(traceFile, traceFormat, network.Places())
+			if err != nil {
+				log.Fatal(err)
+			}
+			defer closeTrace()
+			sim.DoEveryFiring(tracer.Write)
+		}
+		sim.Run(context.Background())
+		fmt.Printf("time: %s (%s)\n", sim.GetNow(), describeEnd(&sim))
+		fmt.Printf("marking: %s\n", network.Places())
+		fmt.Print(sim.Statistics())
+		if batches > 0 {
+			fmt.Print(sim.BatchMeans(confidence))
+		}
+		return
+	}
 
 	////////////////////////////////
 
@@ -138,7 +266,14 @@ func main() {
 		var state State = Splash
 
 		// how to draw
-		var composeNet = compose.GetSimple(network)
+		var collapsed = false // instances of modules drawn as boxes
+		var getComposer = func() compose.Composer {
+			if collapsed {
+				return compose.GetCollapsed(network)
+			}
+			return compose.GetSimple(network)
+		}
+		var composeNet = getComposer()
 
 		var onStateChange = func(before, now time.Duration) {
 			switch timeFlow {
@@ -157,13 +292,36 @@ func main() {
 
 		var sim net.Simulation
 
-		foo := func() {}
-		_ = foo
+		// trace of current simulation, nil if not required
+		var tracer trace.Writer
+		var closeTrace = func() {}
+		var openTrace = func() {
+			closeTrace()
+			if traceFile == "" {
+				return
+			}
+			var closeFile func()
+			var err error
+			tracer, closeFile, err = createTrace(traceFile, traceFormat, network.Places())
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				return
+			}
+			closeTrace = func() {
+				closeFile()
+				tracer = nil
+				closeTrace = func() {}
+			}
+		}
+		defer func() { closeTrace() }()
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
 
 		reloader := makeFileWatcher(func(filename string) {
 			pnString = read(filename)
-			network = parse(pnString)
-			composeNet = compose.GetSimple(network)
+			network = parse(pnString, filename)
+			composeNet = getComposer()
 			sim.Stop()
 			state = Initial
 		})
@@ -178,9 +336,14 @@ func main() {
 			switch state {
 			case Paused:
 				state = Running
+				sim.Resume()
 			case Running:
 				state = Paused
 				sim.Pause()
+				go func() {
+					sim.WaitPaused()
+					screen.SetTitle(sim.GetNow().String() + " paused")
+				}()
 			}
 		}
 		reset := func() {
@@ -190,7 +353,35 @@ func main() {
 				state = Initial
 			}
 		}
+		step := func() {
+			switch state {
+			case Paused:
+				tran, _ := sim.Step()
+				if tran == nil {
+					return
+				}
+				if verbose {
+					fmt.Println(sim.GetNow(), tran.Description, network.Places())
+				}
+				screen.SetTitle(sim.GetNow().String() + " paused")
+				screen.ForceRedraw(false)
+			}
+		}
+		stepBack := func() {
+			switch state {
+			case Paused:
+				if !sim.StepBack() {
+					return
+				}
+				screen.SetTitle(sim.GetNow().String() + " paused")
+				screen.ForceRedraw(false)
+			}
+		}
+		isPaused := func() bool {
+			return state == Paused
+		}
 		quit := func() {
+			cancel()
 			screen.SetShouldClose(true)
 		}
 
@@ -208,6 +399,14 @@ func main() {
 			}()
 		}
 
+		toggleModules := func() {
+			collapsed = !collapsed
+			composeNet = getComposer()
+			if state != Splash {
+				go screen.SetRedrawFunc(gui.RedrawFunc(composeNet))
+			}
+		}
+
 		doExport := func() {
 			export.Png(composeNet)
 			export.Pdf(composeNet)
@@ -219,9 +418,11 @@ func main() {
 		screen.RegisterControl(0, "O", gui.AlwaysIcon(gui.FileIcon), "open", open, gui.True)
 		screen.RegisterControl(0, "R", gui.AlwaysIcon(gui.ReloadIcon), "reload", reloader.action, reloader.isOn)
 		screen.RegisterControl(0, "I", gui.AlwaysIcon(gui.ExportIcon), "export image", doExport, gui.True)
+		screen.OnKey("M", toggleModules) // collapse/expand modules
 
 		// down bar commands (simulation related)
-		screen.RegisterControl(1, "home", gui.AlwaysIcon(gui.PrevIcon), "reset", reset, gui.True)
+		screen.RegisterControl(1, "home", gui.AlwaysIcon(gui.StopIcon), "reset", reset, gui.True)
+		screen.RegisterControl(1, "left", gui.AlwaysIcon(gui.PrevIcon), "step back", stepBack, isPaused)
 		screen.RegisterControl(1, "space", func() gui.Icon {
 			if state != Running {
 				return gui.PlayIcon
@@ -229,6 +430,7 @@ func main() {
 				return gui.PauseIcon
 			}
 		}, "play/pause", playPause, gui.True)
+		screen.RegisterControl(1, "right", gui.AlwaysIcon(gui.NextIcon), "step", step, isPaused)
 
 		for state != Exit {
 			switch state {
@@ -240,8 +442,23 @@ func main() {
 			case Initial:
 				sim = net.NewSimulation(startTime, endTime, network)
 				sim.DoEveryStateChange(onStateChange)
+				openTrace()
+				if tracer != nil {
+					sim.DoEveryFiring(tracer.Write)
+				}
 				if trueRandom {
-					net.TrueRandomSeed()
+					seed = net.TrueRandomSeed()
+				}
+				sim.SetSeed(seed)
+				if err := sim.SetWarmUp(warmUp); err != nil {
+					fmt.Fprintln(os.Stderr, err)
+				}
+				sim.SetBatches(batches)
+				if err := stopWhenConditions(&sim); err != nil {
+					fmt.Fprintln(os.Stderr, err)
+				}
+				if err := sim.SetResources(resourceIds...); err != nil {
+					fmt.Fprintln(os.Stderr, err)
 				}
 				screen.SetRedrawFunc(gui.RedrawFunc(composeNet))
 				if autoStart {
@@ -251,11 +468,18 @@ func main() {
 				}
 				screen.SetTitle(sim.GetNow().String() + " init")
 			case Running:
-				sim.Run()             ////////////////// <--
-				if state != Running { // paused or stopped
+				sim.Run(ctx)          ////////////////// <--
+				if state != Running { // stopped
 					continue
 				}
-				screen.SetTitle(sim.GetNow().String() + " done")
+				closeTrace()
+				if printStats {
+					fmt.Print(sim.Statistics())
+					if batches > 0 {
+						fmt.Print(sim.BatchMeans(confidence))
+					}
+				}
+				screen.SetTitle(sim.GetNow().String() + " done: " + describeEnd(&sim))
 				screen.ForceRedraw(true)
 				if verbose {
 					fmt.Println("----")
@@ -276,3 +500,58 @@ func main() {
 	}) // returns when func returns
 
 }
+
+// creates trace writing to file, close flushes it and closes the file
+func createTrace(filename, format string, places net.Places) (tracer trace.Writer, close func(), err error) {
+	file, err := os.Create(filename)
+	if err != nil {
+		return nil, nil, err
+	}
+	tracer, err = trace.New(format, file, places)
+	if err != nil {
+		file.Close()
+		return nil, nil, err
+	}
+	close = func() {
+		if err := tracer.Close(); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+		}
+		file.Close()
+	}
+	return tracer, close, nil
+}
+
+// why simulation ended, including condition which was met
+func describeEnd(sim *net.Simulation) string {
+	if cond, ok := sim.MetCondition(); ok {
+		return sim.StopReason().String() + ": " + cond.String()
+	}
+	return sim.StopReason().String()
+}
+
+// builds reachability graph and writes it to file in format given by its extension
+func writeReachability(network net.Net, filename string, limit int) error {
+	graph, err := network.Reachability(limit)
+	if err != nil {
+		return err
+	}
+	file, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	switch filepath.Ext(filename) {
+	case ".json":
+		err = graph.WriteJSON(file)
+	default:
+		err = graph.WriteDOT(file)
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%d states, %d edges\n", len(graph.States), len(graph.Edges))
+	if graph.Truncated {
+		fmt.Printf("limit of %d states reached, graph is not complete\n", limit)
+	}
+	return file.Close()
+}
@@ -0,0 +1,53 @@
+package trace
+
+import (
+	"encoding/csv"
+	"git.yo2.cz/drahoslav/penego/net"
+	"io"
+	"strconv"
+)
+
+// CSV writes header and then row per firing:
+// time in seconds, transition, consumed and produced tokens and count of tokens in every place
+type CSV struct {
+	w *csv.Writer
+	places net.Places
+	err error
+}
+
+func NewCSV(w io.Writer, places net.Places) *CSV {
+	trace := &CSV{w: csv.NewWriter(w), places: places}
+	header := []string{"time", "transition", "consumed", "produced"}
+	for i, place := range places {
+		header = append(header, placeName(i, place))
+	}
+	trace.write(header)
+	return trace
+}
+
+func (trace *CSV) write(row []string) {
+	if trace.err == nil {
+		trace.err = trace.w.Write(row)
+	}
+}
+
+func (trace *CSV) Write(firing net.Firing) {
+	row := []string{
+		seconds(firing.Time),
+		transitionName(firing.Transition),
+		firing.Consumed.String(),
+		firing.Produced.String(),
+	}
+	for _, place := range trace.places {
+		row = append(row, strconv.Itoa(place.Tokens))
+	}
+	trace.write(row)
+}
+
+func (trace *CSV) Close() error {
+	trace.w.Flush()
+	if trace.err == nil {
+		trace.err = trace.w.Error()
+	}
+	return trace.err
+}
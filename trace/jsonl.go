@@ -0,0 +1,72 @@
+package trace
+
+import (
+	"bufio"
+	"encoding/json"
+	"git.yo2.cz/drahoslav/penego/net"
+	"io"
+)
+
+// JSONLines writes one json object per firing
+type JSONLines struct {
+	w *bufio.Writer
+	encoder *json.Encoder
+	places net.Places
+	names map[*net.Place]string
+	err error
+}
+
+type record struct {
+	Time json.Number `json:"time"` // seconds
+	Transition string `json:"transition"`
+	Consumed map[string]int `json:"consumed"`
+	Produced map[string]int `json:"produced"`
+	Marking map[string]int `json:"marking"`
+}
+
+func NewJSONLines(w io.Writer, places net.Places) *JSONLines {
+	buffered := bufio.NewWriter(w)
+	trace := &JSONLines{
+		w: buffered,
+		encoder: json.NewEncoder(buffered),
+		places: places,
+		names: map[*net.Place]string{},
+	}
+	trace.encoder.SetEscapeHTML(false) // arrows of transitions stay readable
+	for i, place := range places {
+		trace.names[place] = placeName(i, place)
+	}
+	return trace
+}
+
+func (trace *JSONLines) tokens(arcs net.Arcs) map[string]int {
+	tokens := map[string]int{}
+	for _, arc := range arcs {
+		tokens[trace.names[arc.Place]] += arc.Weight
+	}
+	return tokens
+}
+
+func (trace *JSONLines) Write(firing net.Firing) {
+	if trace.err != nil {
+		return
+	}
+	rec := record{
+		Time: json.Number(seconds(firing.Time)),
+		Transition: transitionName(firing.Transition),
+		Consumed: trace.tokens(firing.Consumed),
+		Produced: trace.tokens(firing.Produced),
+		Marking: map[string]int{},
+	}
+	for _, place := range trace.places {
+		rec.Marking[trace.names[place]] = place.Tokens
+	}
+	trace.err = trace.encoder.Encode(rec) // adds new line
+}
+
+func (trace *JSONLines) Close() error {
+	if err := trace.w.Flush(); trace.err == nil {
+		trace.err = err
+	}
+	return trace.err
+}
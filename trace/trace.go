@@ -0,0 +1,51 @@
+package trace
+
+import (
+	"fmt"
+	"git.yo2.cz/drahoslav/penego/net"
+	"io"
+	"strconv"
+	"time"
+)
+
+// Writer writes one record per firing of transition,
+// Write is intended to be passed to Simulation.DoEveryFiring
+type Writer interface {
+	Write(net.Firing)
+	Close() error // flushes records and returns first error which occurred
+}
+
+// New creates writer of given format: csv or jsonl
+func New(format string, w io.Writer, places net.Places) (Writer, error) {
+	switch format {
+	case "csv":
+		return NewCSV(w, places), nil
+	case "jsonl":
+		return NewJSONLines(w, places), nil
+	}
+	return nil, fmt.Errorf("unknown trace format `%s`, may be: csv, jsonl", format)
+}
+
+// name of place in records, places created without penego notation have no id
+func placeName(i int, place *net.Place) string {
+	if place.Id() != "" {
+		return place.Id()
+	}
+	if place.Description != "" {
+		return place.Description
+	}
+	return "p" + strconv.Itoa(i)
+}
+
+// name of transition in records
+func transitionName(tran *net.Transition) string {
+	if tran.Description != "" {
+		return tran.Description
+	}
+	return tran.String()
+}
+
+// time of record in seconds
+func seconds(t time.Duration) string {
+	return strconv.FormatFloat(t.Seconds(), 'f', -1, 64)
+}